@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Optional import columns describing a user, in this order after the
+// columns each import format starts with (username,password for CSV and
+// name,rollno for Excel). Groups are separated by ';' or spaces, SSH public
+// keys by ';'. The quota is written as block_soft/block_hard[/inode_soft/inode_hard].
+var accountAttributeColumns = []string{"full_name", "primary_group", "groups", "shell", "home", "uid", "gid", "expires_on", "ssh_keys", "quota"}
+
+const defaultShell = "/bin/bash"
+
+var (
+	usernamePattern  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,31}$`)
+	groupNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	shellPattern     = regexp.MustCompile(`^/[A-Za-z0-9._/-]+$`)
+	homePattern      = regexp.MustCompile(`^/[A-Za-z0-9._/-]+$`)
+)
+
+// parseAccountAttributes fills the optional attributes of an account from
+// import columns following accountAttributeColumns
+func parseAccountAttributes(account *UserAccount, cols []string) error {
+	get := func(i int) string {
+		if i < len(cols) {
+			return strings.TrimSpace(cols[i])
+		}
+		return ""
+	}
+
+	if fullName := get(0); fullName != "" {
+		account.FullName = fullName
+	}
+	account.PrimaryGroup = get(1)
+	account.Groups = splitGroups(get(2))
+	account.Shell = get(3)
+	account.Home = get(4)
+
+	for i, field := range []*int{&account.UID, &account.GID} {
+		value := get(5 + i)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n >= 4294967295 {
+			return fieldError(accountAttributeColumns[5+i], value, fmt.Errorf("invalid %s %q", accountAttributeColumns[5+i], value))
+		}
+		*field = n
+	}
+
+	// A per-row expiry date overrides the one given for the whole import
+	if value := get(7); value != "" {
+		expiresOn, err := parseExpiryDate(value)
+		if err != nil {
+			return fieldError("expires_on", value, err)
+		}
+		account.ExpiresOn = expiresOn
+	}
+
+	keys, err := parseSSHKeys(get(8))
+	if err != nil {
+		return fieldError("ssh_keys", get(8), err)
+	}
+	account.SSHKeys = keys
+
+	// A per-row quota overrides the default quota of the import
+	if value := get(9); value != "" {
+		quota, err := parseQuota(value)
+		if err != nil {
+			return fieldError("quota", value, err)
+		}
+		account.Quota = quota
+	}
+
+	return validateAccount(*account)
+}
+
+// splitGroups parses a group list separated by ';', ',' or spaces
+func splitGroups(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' '
+	})
+}
+
+// validateAccount checks that every attribute is safe to pass to useradd
+func validateAccount(account UserAccount) error {
+	if !usernamePattern.MatchString(account.Username) {
+		return fieldError("username", account.Username, fmt.Errorf("invalid username %q", account.Username))
+	}
+	if strings.ContainsAny(account.FullName, ":\n\r") {
+		return fieldError("full_name", account.FullName, fmt.Errorf("full name %q must not contain ':' or line breaks", account.FullName))
+	}
+	if account.PrimaryGroup != "" && !groupNamePattern.MatchString(account.PrimaryGroup) {
+		return fieldError("primary_group", account.PrimaryGroup, fmt.Errorf("invalid primary group %q", account.PrimaryGroup))
+	}
+	for _, group := range account.Groups {
+		if !groupNamePattern.MatchString(group) {
+			return fieldError("groups", group, fmt.Errorf("invalid group %q", group))
+		}
+	}
+	if account.Shell != "" && !shellPattern.MatchString(account.Shell) {
+		return fieldError("shell", account.Shell, fmt.Errorf("shell %q must be an absolute path", account.Shell))
+	}
+	if account.Home != "" && (!homePattern.MatchString(account.Home) || path.Clean(account.Home) != account.Home) {
+		return fieldError("home", account.Home, fmt.Errorf("home directory %q must be a clean absolute path", account.Home))
+	}
+	return nil
+}
+
+// findAccount looks up a managed account by username
+func (server ServerInfo) findAccount(username string) (UserAccount, bool) {
+	return findAccountIn(server.Accounts, username)
+}
+
+// findAccountIn looks up an account by username in a list of accounts
+func findAccountIn(accounts []UserAccount, username string) (UserAccount, bool) {
+	for _, account := range accounts {
+		if account.Username == username {
+			return account, true
+		}
+	}
+	return UserAccount{}, false
+}
+
+// loginShell returns the account's shell, defaulting to bash
+func (account UserAccount) loginShell() string {
+	if account.Shell != "" {
+		return account.Shell
+	}
+	return defaultShell
+}
+
+// useraddCommand builds the useradd invocation for an account
+func useraddCommand(account UserAccount) string {
+	args := []string{"useradd", "-m", "-s", shellQuote(account.loginShell())}
+	if account.Home != "" {
+		args = append(args, "-d", shellQuote(account.Home))
+	}
+	if account.FullName != "" {
+		args = append(args, "-c", shellQuote(account.FullName))
+	}
+	if account.UID > 0 {
+		args = append(args, "-u", strconv.Itoa(account.UID))
+	}
+	if account.GID > 0 {
+		args = append(args, "-g", strconv.Itoa(account.GID))
+	} else if account.PrimaryGroup != "" {
+		args = append(args, "-g", account.PrimaryGroup)
+	}
+	if len(account.Groups) > 0 {
+		args = append(args, "-G", strings.Join(account.Groups, ","))
+	}
+	args = append(args, account.Username)
+	return strings.Join(args, " ")
+}
+
+// ensureGroupsCommand creates the primary and supplementary groups of an
+// account that do not exist yet; it returns "" when nothing is needed
+func ensureGroupsCommand(account UserAccount) string {
+	var steps []string
+	if account.GID > 0 {
+		name := account.PrimaryGroup
+		if name == "" {
+			name = account.Username
+		}
+		steps = append(steps, fmt.Sprintf("(getent group %d >/dev/null || groupadd -g %d %s)", account.GID, account.GID, name))
+	} else if account.PrimaryGroup != "" {
+		steps = append(steps, fmt.Sprintf("(getent group %s >/dev/null || groupadd %s)", account.PrimaryGroup, account.PrimaryGroup))
+	}
+	for _, group := range account.Groups {
+		steps = append(steps, fmt.Sprintf("(getent group %s >/dev/null || groupadd %s)", group, group))
+	}
+	if len(steps) == 0 {
+		return ""
+	}
+	return "sh -c " + shellQuote(strings.Join(steps, " && "))
+}
+
+// chpasswdCommand sets a user's password through chpasswd under sudo,
+// keeping the password off every command line
+func chpasswdCommand(rootPassword, username, password string) string {
+	return sudoInputCommand(rootPassword, "chpasswd", username+":"+password)
+}
+
+// Steps of creating an account that run once useradd succeeded, reported
+// separately as the user exists even when they fail
+const (
+	stepPassword = "password"
+	stepExpiry   = "expiry date"
+	stepKeys     = "SSH keys"
+	stepQuota    = "quota"
+)
+
+// createStep is a command run after useradd, reported under its own name
+type createStep struct {
+	Name    string
+	Command string
+}
+
+// createSteps returns the steps that complete a new account after useradd
+func createSteps(rootPassword string, account UserAccount) []createStep {
+	steps := []createStep{{stepPassword, passwordCommand(rootPassword, account)}}
+	if account.ExpiresOn != "" {
+		steps = append(steps, createStep{stepExpiry, sudoCommand(rootPassword, "chage -E "+account.ExpiresOn+" "+account.Username)})
+	}
+	if len(account.SSHKeys) > 0 {
+		steps = append(steps, createStep{stepKeys, authorizedKeysCommand(rootPassword, account.Username, account.SSHKeys)})
+	}
+	if account.Quota != nil {
+		steps = append(steps, createStep{stepQuota, setquotaCommand(rootPassword, account.Username, account.Quota, appSettings)})
+	}
+	return steps
+}
+
+// createUserScript builds the script creating one account with its groups
+// and stored password or password hash. The key is marked as succeeded once
+// useradd did, and every later step, including the extra ones, is marked
+// under key:step; read the results with createResults.
+func createUserScript(rootPassword, key string, account UserAccount, extra ...createStep) string {
+	create := sudoCommand(rootPassword, useraddCommand(account))
+	if ensure := ensureGroupsCommand(account); ensure != "" {
+		create = sudoCommand(rootPassword, ensure) + " && " + create
+	}
+
+	var script strings.Builder
+	script.WriteString(fmt.Sprintf("if %s; then\necho '%s %s'\n", create, resultOKMarker, key))
+	for _, step := range append(createSteps(rootPassword, account), extra...) {
+		script.WriteString(markResult(key+":"+step.Name, step.Command))
+	}
+	script.WriteString(fmt.Sprintf("else echo '%s %s'; fi\n", resultFailMarker, key))
+	return script.String()
+}
+
+// createResults reads the results of a createUserScript: whether the user
+// was created, and which of the steps completing it failed
+func createResults(results map[string]bool, key string, account UserAccount) (bool, []string) {
+	var failed []string
+	for _, step := range createSteps("", account) {
+		if !results[key+":"+step.Name] {
+			failed = append(failed, step.Name)
+		}
+	}
+	return results[key], failed
+}
+
+// createdLog is the log line of a created account, naming the steps that
+// failed
+func createdLog(username string, failed []string) string {
+	if len(failed) == 0 {
+		return fmt.Sprintf("✅ %s: created\n", username)
+	}
+	return fmt.Sprintf("⚠️ %s: created, but setting its %s failed\n", username, strings.Join(failed, ", "))
+}
+
+// withoutFailedSteps returns the account as it was created, without what
+// the failed steps were to set, so the store does not claim it
+func (account UserAccount) withoutFailedSteps(failed []string) UserAccount {
+	for _, step := range failed {
+		switch step {
+		case stepPassword:
+			account.Password, account.PasswordHash = "", ""
+		case stepExpiry:
+			account.ExpiresOn, account.DeleteOnExpiry = "", false
+		case stepKeys:
+			account.SSHKeys = nil
+		case stepQuota:
+			account.Quota = nil
+		}
+	}
+	return account
+}
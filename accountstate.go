@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Layout of account expiry dates, as accepted by chage -E
+const dateLayout = "2006-01-02"
+
+// AccountAction is a state change of one account: lock, unlock or expire.
+// For expire an empty ExpiresOn removes the expiry date.
+type AccountAction struct {
+	Username  string
+	Action    string
+	ExpiresOn string
+	// DeleteOnExpiry opts an "expire" action into or out of deletion after
+	// the grace period; nil keeps the account's choice
+	DeleteOnExpiry *bool
+}
+
+// State returns the account state shown on the dashboard: active, locked or
+// expired
+func (account UserAccount) State() string {
+	if account.Locked {
+		return "locked"
+	}
+	if account.Expired(time.Now()) {
+		return "expired"
+	}
+	return "active"
+}
+
+// Expired reports whether the account's expiry date has passed
+func (account UserAccount) Expired(now time.Time) bool {
+	if account.ExpiresOn == "" {
+		return false
+	}
+	expires, err := time.ParseInLocation(dateLayout, account.ExpiresOn, time.Local)
+	return err == nil && !now.Before(expires)
+}
+
+// parseExpiryDate validates an expiry date; "" and "never" clear it
+func parseExpiryDate(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "never") {
+		return "", nil
+	}
+	if _, err := time.Parse(dateLayout, s); err != nil {
+		return "", fmt.Errorf("invalid expiry date %q, expected YYYY-MM-DD", s)
+	}
+	return s, nil
+}
+
+// accountActionCommand builds the remote command for an account action.
+// Locking also switches the shell to nologin so key-based logins stop too;
+// unlocking restores the account's shell.
+func accountActionCommand(rootPassword string, account UserAccount, action AccountAction) string {
+	switch action.Action {
+	case "lock":
+		return sudoCommand(rootPassword, "sh -c "+shellQuote(
+			"s=/usr/sbin/nologin; [ -x $s ] || s=/sbin/nologin; usermod -L -s $s "+account.Username))
+	case "unlock":
+		return sudoCommand(rootPassword, "usermod -U -s "+shellQuote(account.loginShell())+" "+account.Username)
+	case "expire":
+		expires := "-1"
+		if action.ExpiresOn != "" {
+			expires = action.ExpiresOn
+		}
+		return sudoCommand(rootPassword, "chage -E "+expires+" "+account.Username)
+	}
+	return ""
+}
+
+// accountStateHandler shows the bulk lock, unlock and expiry page
+func accountStateHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+	data := map[string]interface{}{
+		"Servers": ipMap,
+		"IP":      ip,
+	}
+	if server, ok := ipMap[ip]; ok {
+		data["Server"] = server
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/account_state.html"))
+	tmpl.Execute(w, data)
+}
+
+// lockAccountsHandler locks or unlocks one user or the selected users
+func lockAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	if _, ok := ipMap[ip]; !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	action := r.FormValue("action")
+	if action != "lock" && action != "unlock" {
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	usernames := formUsernames(r)
+	if len(usernames) == 0 {
+		http.Error(w, "❌ No users selected", http.StatusBadRequest)
+		return
+	}
+
+	var actions []AccountAction
+	for _, username := range usernames {
+		actions = append(actions, AccountAction{Username: username, Action: action})
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, applyAccountActions(ip, actions))
+}
+
+// expireAccountsHandler sets or clears the expiry date of the selected users
+func expireAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	if _, ok := ipMap[ip]; !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	expiresOn, err := parseExpiryDate(r.FormValue("expires_on"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	usernames := formUsernames(r)
+	if len(usernames) == 0 {
+		http.Error(w, "❌ No users selected", http.StatusBadRequest)
+		return
+	}
+
+	var actions []AccountAction
+	for _, username := range usernames {
+		actions = append(actions, AccountAction{Username: username, Action: "expire", ExpiresOn: expiresOn})
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, applyAccountActions(ip, actions))
+}
+
+// accountStateFileHandler applies lock, unlock and expire actions from an
+// uploaded CSV or Excel file with username, action and optional date columns
+func accountStateFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	if _, ok := ipMap[ip]; !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := readUploadedRows(r, "statefile")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var logBuilder strings.Builder
+	var actions []AccountAction
+	for _, row := range rows {
+		if len(row) < 2 || strings.TrimSpace(row[0]) == "" {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped invalid row: %v\n", row))
+			continue
+		}
+
+		action := AccountAction{
+			Username: strings.TrimSpace(row[0]),
+			Action:   strings.ToLower(strings.TrimSpace(row[1])),
+		}
+		switch action.Action {
+		case "lock", "unlock":
+		case "expire":
+			date := ""
+			if len(row) > 2 {
+				date = row[2]
+			}
+			action.ExpiresOn, err = parseExpiryDate(date)
+			if err != nil {
+				logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: %v\n", action.Username, err))
+				continue
+			}
+		default:
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: unknown action %q\n", action.Username, row[1]))
+			continue
+		}
+		actions = append(actions, action)
+	}
+
+	logBuilder.WriteString(applyAccountActions(ip, actions))
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// formUsernames returns the users named by a single "username" field or the
+// "selected_users" checkboxes of a form
+func formUsernames(r *http.Request) []string {
+	if username := strings.TrimSpace(r.FormValue("username")); username != "" {
+		return []string{username}
+	}
+	return r.Form["selected_users"]
+}
+
+// applyAccountActions runs account actions on a server in one session and
+// records the new state only for the actions that succeeded
+func applyAccountActions(ip string, actions []AccountAction) string {
+	server := ipMap[ip]
+
+	var logBuilder strings.Builder
+	var script strings.Builder
+	var valid []AccountAction
+	for _, action := range actions {
+		account, found := server.findAccount(action.Username)
+		if !found {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: not a managed account\n", action.Username))
+			continue
+		}
+		script.WriteString(markResult(action.Username+":"+action.Action, accountActionCommand(server.RootPassword, account, action)))
+		valid = append(valid, action)
+	}
+
+	if len(valid) == 0 {
+		logBuilder.WriteString("⚠️ No account changes to apply.\n")
+		return logBuilder.String()
+	}
+
+	logBuilder.WriteString(fmt.Sprintf("🔒 Updating %d accounts on %s\n\n", len(valid), ip))
+
+	output, err := runRemoteUnlocked(ip, server, script.String())
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	}
+	results, rest := parseResults(output)
+	server, ok := ipMap[ip]
+	if !ok {
+		return logBuilder.String() + serverRemovedLog
+	}
+
+	for _, action := range valid {
+		if !results[action.Username+":"+action.Action] {
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: %s failed\n", action.Username, action.Action))
+			continue
+		}
+		for i := range server.Accounts {
+			if server.Accounts[i].Username != action.Username {
+				continue
+			}
+			switch action.Action {
+			case "lock":
+				server.Accounts[i].Locked = true
+				logBuilder.WriteString(fmt.Sprintf("🔒 %s: locked\n", action.Username))
+			case "unlock":
+				server.Accounts[i].Locked = false
+				logBuilder.WriteString(fmt.Sprintf("🔓 %s: unlocked\n", action.Username))
+			case "expire":
+				server.Accounts[i].ExpiresOn = action.ExpiresOn
+				if action.DeleteOnExpiry != nil {
+					server.Accounts[i].DeleteOnExpiry = *action.DeleteOnExpiry
+				}
+				server.Accounts[i].RemindedOn = ""
+				if action.ExpiresOn == "" {
+					server.Accounts[i].DeleteOnExpiry = false
+					logBuilder.WriteString(fmt.Sprintf("✅ %s: expiry date removed\n", action.Username))
+				} else {
+					logBuilder.WriteString(fmt.Sprintf("✅ %s: expires on %s\n", action.Username, action.ExpiresOn))
+				}
+			}
+		}
+	}
+
+	ipMap[ip] = server
+	saveIPMap()
+
+	if rest != "" {
+		logBuilder.WriteString("\nOutput:\n" + rest)
+	}
+	return logBuilder.String()
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Local directory holding archives copied back from the servers
+const localArchiveDir = "archives"
+
+// Prefix of the markResult keys of home directory archives, followed by
+// "<username>:<archive path>"
+const archiveResultPrefix = "archive:"
+
+// Prefix of the markResult keys of deleted users, followed by the username
+const deleteResultPrefix = "delete:"
+
+// Exit status of archiveHomeCommand for a user without a home directory
+const noHomeStatus = 3
+
+// HomeArchive is a home directory archived before its user was deleted. The
+// account is kept so the user can be recreated on restore.
+type HomeArchive struct {
+	ID         string      `json:"id"`
+	Account    UserAccount `json:"account"`
+	RemotePath string      `json:"remote_path,omitempty"`
+	LocalPath  string      `json:"local_path,omitempty"`
+	Created    time.Time   `json:"created"`
+}
+
+// archivePath returns where a user's home directory is archived before
+// deletion, or "" when archiving is turned off
+func archivePath(settings Settings, username string) string {
+	if !settings.ArchiveBeforeDelete || !usernamePattern.MatchString(username) {
+		return ""
+	}
+	return path.Join(settings.ArchiveDir, fmt.Sprintf("%s-%s.tar.gz", username, time.Now().Format("20060102-150405")))
+}
+
+// archiveHomeCommand tars a user's home directory to archivePath. Paths are
+// stored relative to / so the archive unpacks to the same place. It exits
+// with noHomeStatus when the user has no home directory to archive.
+func archiveHomeCommand(rootPassword, username, archivePath string) string {
+	script := fmt.Sprintf(`h=$(getent passwd "$1" | cut -d: -f6); { [ -n "$h" ] && [ -d "$h" ]; } || exit %d; `+
+		`mkdir -p %s && tar -czf %s -C / "${h#/}" && chmod 600 %s`,
+		noHomeStatus, shellQuote(path.Dir(archivePath)), shellQuote(archivePath), shellQuote(archivePath))
+	return sudoCommand(rootPassword, "sh -c "+shellQuote(script)+" sh "+shellQuote(username))
+}
+
+// deleteUserScript builds the script deleting a user and their home
+// directory. It prints the delete result of the user, which succeeds when
+// userdel did or the user was already gone. With an archive path the home
+// directory is archived first, and the user is only deleted when that
+// worked or there was no home directory.
+func deleteUserScript(rootPassword, username, archivePath string) string {
+	quoted := shellQuote(username)
+	userdel := markResult(deleteResultPrefix+username, sudoCommand(rootPassword, "userdel -r "+quoted))
+	gone := fmt.Sprintf("echo %s; echo %s\n", shellQuote("User "+username+" not found or already deleted"),
+		shellQuote(resultOKMarker+" "+deleteResultPrefix+username))
+	if archivePath == "" {
+		return fmt.Sprintf("if getent passwd %s >/dev/null; then\n%selse %sfi\n", quoted, userdel, gone)
+	}
+
+	key := shellQuote(archiveResultPrefix + username + ":" + archivePath)
+	return fmt.Sprintf("if getent passwd %s >/dev/null; then\n%s; a=$?\n"+
+		"if [ $a -eq 0 ]; then echo '%s' %s; elif [ $a -ne %d ]; then echo '%s' %s; fi\n"+
+		"if [ $a -eq 0 ] || [ $a -eq %d ]; then\n%sfi\nelse %sfi\n",
+		quoted, archiveHomeCommand(rootPassword, username, archivePath),
+		resultOKMarker, key, noHomeStatus, resultFailMarker, key,
+		noHomeStatus, userdel, gone)
+}
+
+// recordArchives reads the results of a delete script, adds the archives
+// to the server's catalog and returns the log together with the users that
+// were deleted. Users whose archive or userdel failed are not.
+func recordArchives(ip string, server *ServerInfo, output string, settings Settings) (string, map[string]bool) {
+	results, rest := parseResults(output)
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(catalogArchives(ip, server, results, settings))
+
+	deleted := deletedUsers(results)
+	var usernames []string
+	for username := range deleted {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+	for _, username := range usernames {
+		if deleted[username] {
+			logBuilder.WriteString(fmt.Sprintf("🗑️ Deleted %s\n", username))
+		} else {
+			logBuilder.WriteString(fmt.Sprintf("❌ Deleting %s failed, user kept\n", username))
+		}
+	}
+
+	logBuilder.WriteString(rest)
+	return logBuilder.String(), deleted
+}
+
+// deletedUsers returns the delete results of a delete script by username
+func deletedUsers(results map[string]bool) map[string]bool {
+	deleted := make(map[string]bool)
+	for key, ok := range results {
+		if username, found := strings.CutPrefix(key, deleteResultPrefix); found {
+			deleted[username] = ok
+		}
+	}
+	return deleted
+}
+
+// catalogArchives adds the archives a delete script wrote to the server's
+// catalog and returns the log of the archive results
+func catalogArchives(ip string, server *ServerInfo, results map[string]bool, settings Settings) string {
+	var keys []string
+	for key := range results {
+		if strings.HasPrefix(key, archiveResultPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var logBuilder strings.Builder
+	for _, key := range keys {
+		username, archivePath, _ := strings.Cut(strings.TrimPrefix(key, archiveResultPrefix), ":")
+		if !results[key] {
+			logBuilder.WriteString(fmt.Sprintf("❌ Archiving the home directory of %s failed, user not deleted\n", username))
+			continue
+		}
+
+		account, found := server.findAccount(username)
+		if !found {
+			account = UserAccount{Username: username}
+		}
+		archive, msg := newHomeArchive(ip, *server, account, archivePath, settings)
+		server.Archives = append(server.Archives, archive)
+		logBuilder.WriteString(msg)
+	}
+	return logBuilder.String()
+}
+
+// newHomeArchive catalogs an archive written on a server, first copying it
+// back and removing it from the server when ArchivePull is set
+func newHomeArchive(ip string, server ServerInfo, account UserAccount, remotePath string, settings Settings) (HomeArchive, string) {
+	archive := HomeArchive{
+		ID:         newID(),
+		Account:    account,
+		RemotePath: remotePath,
+		Created:    time.Now(),
+	}
+	if !settings.ArchivePull {
+		return archive, fmt.Sprintf("📦 Archived the home directory of %s to %s\n", account.Username, remotePath)
+	}
+
+	localPath, err := pullArchive(ip, server, remotePath)
+	if err != nil {
+		return archive, fmt.Sprintf("⚠️ Archived the home directory of %s to %s but could not copy it back: %v\n", account.Username, remotePath, err)
+	}
+	archive.LocalPath = localPath
+	archive.RemotePath = ""
+	runRemoteCommand(ip, server.RootUsername, server.RootPassword, sudoCommand(server.RootPassword, "rm -f "+shellQuote(remotePath)))
+	return archive, fmt.Sprintf("📦 Archived the home directory of %s to %s\n", account.Username, localPath)
+}
+
+// pullArchive copies an archive from a server into localArchiveDir. The
+// archive is streamed through sudo cat over SSH rather than SFTP because it
+// is only readable by root.
+func pullArchive(ip string, server ServerInfo, remotePath string) (string, error) {
+	dir := filepath.Join(localArchiveDir, ip)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	localPath := filepath.Join(dir, path.Base(remotePath))
+
+	out, err := os.OpenFile(localPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	client, err := dialServer(ip, server.RootUsername, server.RootPassword)
+	if err != nil {
+		os.Remove(localPath)
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		os.Remove(localPath)
+		return "", err
+	}
+	defer session.Close()
+
+	// The command goes in as a script, like runRemoteCommand does, so the
+	// root password is not on the remote command line
+	var stderr strings.Builder
+	session.Stdout = out
+	session.Stderr = &stderr
+	session.Stdin = strings.NewReader(sudoCommand(server.RootPassword, "cat "+shellQuote(remotePath)) + "\n")
+	if err := runWithDeadline(client, session, "sh -s"); err != nil {
+		os.Remove(localPath)
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return localPath, nil
+}
+
+// pushArchive uploads a local archive to a temporary file on a server
+func pushArchive(ip string, server ServerInfo, localPath string) (string, error) {
+	in, err := os.Open(localPath)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	client, err := dialServer(ip, server.RootUsername, server.RootPassword)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	remotePath := "/tmp/restore-" + newID() + ".tar.gz"
+	var output strings.Builder
+	session.Stdin = in
+	session.Stdout = &output
+	session.Stderr = &output
+	if err := runWithDeadline(client, session, "umask 077 && cat > "+remotePath); err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(output.String()))
+	}
+	return remotePath, nil
+}
+
+// findArchive looks up an archive of a server by ID
+func (server ServerInfo) findArchive(id string) (int, bool) {
+	for i, archive := range server.Archives {
+		if archive.ID == id {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// ArchiveView is one catalog entry on the archives page
+type ArchiveView struct {
+	Server  string
+	Archive HomeArchive
+	Managed bool
+}
+
+// archivesHandler lists the home directory archives and the archive settings
+func archivesHandler(w http.ResponseWriter, r *http.Request) {
+	var views []ArchiveView
+	for ip, server := range ipMap {
+		for _, archive := range server.Archives {
+			_, managed := server.findAccount(archive.Account.Username)
+			views = append(views, ArchiveView{Server: ip, Archive: archive, Managed: managed})
+		}
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Archive.Created.After(views[j].Archive.Created)
+	})
+
+	tmpl := template.Must(template.ParseFiles("templates/archives.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Archives": views,
+		"Settings": appSettings,
+		"Message":  r.URL.Query().Get("message"),
+	})
+}
+
+// archiveSettingsHandler updates whether and where home directories are archived
+func archiveSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dir := strings.TrimSpace(r.FormValue("archive_dir"))
+	if !homePattern.MatchString(dir) || path.Clean(dir) != dir || dir == "/" {
+		http.Error(w, "❌ The archive directory must be a clean absolute path", http.StatusBadRequest)
+		return
+	}
+
+	appSettings.ArchiveBeforeDelete = r.FormValue("archive_before_delete") == "on"
+	appSettings.ArchiveDir = dir
+	appSettings.ArchivePull = r.FormValue("archive_pull") == "on"
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/archives?message=Settings+saved", http.StatusSeeOther)
+}
+
+// restoreArchiveHandler recreates an archived user and unpacks their home
+// directory
+func restoreArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	i, ok := server.findArchive(r.FormValue("id"))
+	if !ok {
+		http.Error(w, "Archive not found", http.StatusNotFound)
+		return
+	}
+	archive := server.Archives[i]
+
+	account := archive.Account
+	if _, exists := server.findAccount(account.Username); exists {
+		http.Error(w, "❌ "+account.Username+" is already a managed account", http.StatusConflict)
+		return
+	}
+	if err := validateAccount(account); err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(fmt.Sprintf("📦 Restoring %s on %s\n\n", account.Username, ip))
+
+	source := archive.RemotePath
+	if source == "" {
+		var uploaded string
+		var err error
+		withStoreUnlocked(func() { uploaded, err = pushArchive(ip, server, archive.LocalPath) })
+		if err != nil {
+			logBuilder.WriteString(fmt.Sprintf("❌ Could not upload the archive: %v\n", err))
+			tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+			tmpl.Execute(w, logBuilder.String())
+			return
+		}
+		source = uploaded
+	}
+
+	// The user is recreated active; an old expiry date would lock or
+	// delete it again right away
+	account.Locked = false
+	account.ExpiresOn = ""
+	account.RemindedOn = ""
+
+	// Keep the stored password or hash; without one the user gets a new
+	// password, handed out once on servers that keep no plaintext
+	var credentials []Credential
+	if !account.hasPassword() {
+		password := randomPassword(randomPasswordLength)
+		if server.hashesPasswords(appSettings) {
+			credentials = append(credentials, Credential{Username: account.Username, Password: password})
+		}
+		account.setPassword(password, server.hashesPasswords(appSettings))
+	}
+	unpack := createStep{"home directory", sudoCommand(server.RootPassword, "sh -c "+shellQuote(fmt.Sprintf(
+		`tar -xzf %s -C / && h=$(getent passwd %s | cut -d: -f6) && chown -R %s: "$h"`,
+		shellQuote(source), account.Username, account.Username)))}
+	script := createUserScript(server.RootPassword, "restore", account, unpack)
+	if source != archive.RemotePath {
+		script += "rm -f " + shellQuote(source) + "\n"
+	}
+
+	output, err := runRemoteUnlocked(ip, server, script)
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	}
+	results, rest := parseResults(output)
+	server, ok = ipMap[ip]
+
+	switch {
+	case !ok:
+		logBuilder.WriteString(serverRemovedLog)
+	case results["restore"]:
+		_, failed := createResults(results, "restore", account)
+		account = account.withoutFailedSteps(failed)
+		if _, found := server.findAccount(account.Username); !found {
+			server.Accounts = append(server.Accounts, account)
+		}
+		server.registerGroups(append(account.Groups, account.PrimaryGroup)...)
+		ipMap[ip] = server
+		saveIPMap()
+		if !results["restore:"+unpack.Name] {
+			failed = append(failed, unpack.Name)
+		}
+		switch {
+		case len(failed) > 0:
+			logBuilder.WriteString(fmt.Sprintf("⚠️ %s recreated, but restoring its %s failed; the archive is kept\n",
+				account.Username, strings.Join(failed, ", ")))
+		case len(credentials) > 0:
+			logBuilder.WriteString(fmt.Sprintf("✅ %s restored with a new password\n", account.Username))
+			logBuilder.WriteString(newHandout(ip, "Restore", credentials))
+		case account.Password != "":
+			logBuilder.WriteString(fmt.Sprintf("✅ %s restored with password %s\n", account.Username, account.Password))
+		default:
+			logBuilder.WriteString(fmt.Sprintf("✅ %s restored with its stored password hash\n", account.Username))
+		}
+	default:
+		logBuilder.WriteString(fmt.Sprintf("❌ Restoring %s failed\n", account.Username))
+	}
+	if rest != "" {
+		logBuilder.WriteString("\nOutput:\n" + rest)
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// deleteArchiveHandler removes an archive from the server or local disk and
+// from the catalog
+func deleteArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	i, ok := server.findArchive(r.FormValue("id"))
+	if !ok {
+		http.Error(w, "Archive not found", http.StatusNotFound)
+		return
+	}
+	archive := server.Archives[i]
+
+	if archive.RemotePath != "" {
+		_, err := runRemoteUnlocked(ip, server, sudoCommand(server.RootPassword, "rm -f "+shellQuote(archive.RemotePath)))
+		if err != nil {
+			http.Error(w, "❌ Could not remove the archive from the server: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	if archive.LocalPath != "" {
+		os.Remove(archive.LocalPath)
+	}
+
+	// The catalog may have changed while the server was reached
+	server, ok = ipMap[ip]
+	if i, found := server.findArchive(archive.ID); ok && found {
+		server.Archives = append(server.Archives[:i], server.Archives[i+1:]...)
+		ipMap[ip] = server
+		saveIPMap()
+	}
+	http.Redirect(w, r, "/archives?message=Archive+deleted", http.StatusSeeOther)
+}
+
+// downloadArchiveHandler serves an archive that was copied back locally
+func downloadArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	server, ok := ipMap[strings.TrimSpace(r.URL.Query().Get("server_ip"))]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	i, ok := server.findArchive(r.URL.Query().Get("id"))
+	if !ok || server.Archives[i].LocalPath == "" {
+		http.Error(w, "Archive not available locally", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(server.Archives[i].LocalPath)
+	if err != nil {
+		http.Error(w, "Error opening archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filepath.Base(server.Archives[i].LocalPath))
+	io.Copy(w, f)
+}
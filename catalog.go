@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const catalogFile = "software_catalog.json"
+
+// Built-in catalog written to catalogFile on first start
+var defaultSoftwareCatalog = []Software{
+	{
+		Name:        "nginx",
+		Description: "Web server",
+		Packages:    map[string][]string{"default": {"nginx"}},
+		Services:    []string{"nginx"},
+	},
+	{
+		Name:        "python3",
+		Description: "Python programming language",
+		Packages: map[string][]string{
+			"default": {"python3"},
+			"pacman":  {"python"},
+		},
+	},
+	{
+		Name:        "nodejs",
+		Description: "JavaScript runtime",
+		Packages:    map[string][]string{"default": {"nodejs", "npm"}},
+	},
+	{
+		Name:        "git",
+		Description: "Version control system",
+		Packages:    map[string][]string{"default": {"git"}},
+	},
+	{
+		Name:        "docker",
+		Description: "Container platform",
+		Packages: map[string][]string{
+			"default": {"docker"},
+			"apt":     {"docker.io"},
+			"dnf":     {"moby-engine"},
+			"rocky":   {"podman-docker"},
+		},
+		Services: []string{"docker"},
+	},
+	{
+		Name:        "postgresql",
+		Description: "SQL database",
+		Packages: map[string][]string{
+			"default": {"postgresql"},
+			"dnf":     {"postgresql-server"},
+			"yum":     {"postgresql-server"},
+			"zypper":  {"postgresql-server"},
+		},
+	},
+	{
+		Name:        "mysql",
+		Description: "MySQL database",
+		Packages: map[string][]string{
+			"default": {"mariadb"},
+			"apk":     {"mysql", "mysql-client"},
+			"apt":     {"default-mysql-server", "default-mysql-client"},
+			"dnf":     {"mysql-server"},
+		},
+	},
+	{
+		Name:        "vim",
+		Description: "Text editor",
+		Packages: map[string][]string{
+			"default": {"vim"},
+			"dnf":     {"vim-enhanced"},
+			"yum":     {"vim-enhanced"},
+		},
+	},
+	{
+		Name:        "curl",
+		Description: "Command line tool for transferring data",
+		Packages:    map[string][]string{"default": {"curl"}},
+	},
+	{
+		Name:        "wget",
+		Description: "Command line tool for retrieving files",
+		Packages:    map[string][]string{"default": {"wget"}},
+	},
+}
+
+var (
+	catalogNamePattern    = regexp.MustCompile(`^[A-Za-z0-9._+-]+$`)
+	catalogPackagePattern = regexp.MustCompile(`^[A-Za-z0-9@_][A-Za-z0-9@._+-]*$`)
+	catalogVersionPattern = regexp.MustCompile(`^[A-Za-z0-9.:~+_-]+$`)
+	catalogServicePattern = regexp.MustCompile(`^[A-Za-z0-9@_][A-Za-z0-9@._-]*$`)
+)
+
+func loadSoftwareCatalog() error {
+	data, err := os.ReadFile(catalogFile)
+	if os.IsNotExist(err) {
+		softwareCatalog = defaultSoftwareCatalog
+		return saveSoftwareCatalog()
+	}
+	if err != nil {
+		softwareCatalog = defaultSoftwareCatalog
+		return err
+	}
+
+	catalog, err := parseSoftwareCatalog(data)
+	if err != nil {
+		softwareCatalog = defaultSoftwareCatalog
+		return err
+	}
+	softwareCatalog = catalog
+	return nil
+}
+
+func saveSoftwareCatalog() error {
+	data, err := json.MarshalIndent(softwareCatalog, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(catalogFile, data, 0644)
+}
+
+// parseSoftwareCatalog decodes and validates a catalog document
+func parseSoftwareCatalog(data []byte) ([]Software, error) {
+	var catalog []Software
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i, s := range catalog {
+		if !catalogNamePattern.MatchString(s.Name) {
+			return nil, fmt.Errorf("entry %d: invalid name %q", i+1, s.Name)
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("entry %d: duplicate name %q", i+1, s.Name)
+		}
+		seen[s.Name] = true
+
+		if len(s.Packages) == 0 {
+			return nil, fmt.Errorf("%s: no packages defined", s.Name)
+		}
+		for distro, pkgs := range s.Packages {
+			if len(pkgs) == 0 {
+				return nil, fmt.Errorf("%s: empty package list for %q", s.Name, distro)
+			}
+			for _, pkg := range pkgs {
+				if !catalogPackagePattern.MatchString(pkg) {
+					return nil, fmt.Errorf("%s: invalid package name %q", s.Name, pkg)
+				}
+			}
+		}
+		for pkg, version := range s.Versions {
+			if !catalogVersionPattern.MatchString(version) {
+				return nil, fmt.Errorf("%s: invalid version %q for %s", s.Name, version, pkg)
+			}
+		}
+		for _, svc := range s.Services {
+			if !catalogServicePattern.MatchString(svc) {
+				return nil, fmt.Errorf("%s: invalid service name %q", s.Name, svc)
+			}
+		}
+	}
+	return catalog, nil
+}
+
+// findSoftware looks up a catalog entry by name
+func findSoftware(name string) (Software, bool) {
+	for _, s := range softwareCatalog {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Software{}, false
+}
+
+// packagesFor resolves the package list for a server, preferring its
+// distribution ID, then its package manager, then the default list
+func (s Software) packagesFor(server ServerInfo) []string {
+	for _, key := range []string{server.OSID, server.PackageManager, "default"} {
+		if pkgs, ok := s.Packages[key]; ok && key != "" {
+			return pkgs
+		}
+	}
+	return nil
+}
+
+// installScript builds the full script for a catalog entry: pre-install
+// script, package installation with version pins, services, post-install script
+func (s Software) installScript(server ServerInfo, pm PackageManager) (string, []string, error) {
+	pkgs := s.packagesFor(server)
+	if len(pkgs) == 0 {
+		return "", nil, fmt.Errorf("%s has no packages for %s (%s)", s.Name, server.OSID, pm.Name)
+	}
+
+	var warnings []string
+	var targets []string
+	for _, pkg := range pkgs {
+		target, ok := pm.pinned(pkg, s.Versions[pkg])
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s does not support version pins, installing latest %s", pm.Name, pkg))
+		}
+		targets = append(targets, target)
+	}
+
+	var script strings.Builder
+	script.WriteString("set -e\n")
+	if strings.TrimSpace(s.PreInstall) != "" {
+		script.WriteString(sudoCommand(server.RootPassword, "sh -c "+shellQuote(s.PreInstall)) + "\n")
+	}
+	script.WriteString(pm.installScript(server.RootPassword, targets))
+	for _, svc := range s.Services {
+		script.WriteString(serviceEnableScript(server.RootPassword, svc))
+	}
+	if strings.TrimSpace(s.PostInstall) != "" {
+		script.WriteString(sudoCommand(server.RootPassword, "sh -c "+shellQuote(s.PostInstall)) + "\n")
+	}
+	return script.String(), warnings, nil
+}
+
+// serviceEnableScript enables and starts a service under systemd or OpenRC
+func serviceEnableScript(rootPassword, service string) string {
+	return fmt.Sprintf("if command -v systemctl >/dev/null 2>&1; then %s; elif command -v rc-update >/dev/null 2>&1; then %s && %s; fi\n",
+		sudoCommand(rootPassword, "systemctl enable --now "+service),
+		sudoCommand(rootPassword, "rc-update add "+service+" default"),
+		sudoCommand(rootPassword, "rc-service "+service+" start"))
+}
+
+// catalogHandler shows the software catalog and saves edits to it
+func catalogHandler(w http.ResponseWriter, r *http.Request) {
+	var message string
+	var document string
+
+	if r.Method == http.MethodPost {
+		document = r.FormValue("catalog")
+		catalog, err := parseSoftwareCatalog([]byte(document))
+		if err != nil {
+			message = "❌ Catalog not saved: " + err.Error()
+		} else {
+			softwareCatalog = catalog
+			if err := saveSoftwareCatalog(); err != nil {
+				message = "❌ Error writing " + catalogFile + ": " + err.Error()
+			} else {
+				message = fmt.Sprintf("✅ Catalog saved with %d entries", len(catalog))
+				document = ""
+			}
+		}
+	}
+
+	if document == "" {
+		data, _ := json.MarshalIndent(softwareCatalog, "", "  ")
+		document = string(data)
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/software_catalog.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Software": softwareCatalog,
+		"Document": document,
+		"Message":  message,
+	})
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestParseSoftwareCatalog(t *testing.T) {
+	if _, err := parseSoftwareCatalog([]byte(`[{"name": "web", "packages": {"default": ["nginx", "libc++1", "@core"]}, "services": ["nginx@main"]}]`)); err != nil {
+		t.Errorf("valid catalog rejected: %v", err)
+	}
+
+	// Names starting with a dash would reach apt-get, dnf or systemctl as
+	// options
+	for _, doc := range []string{
+		`[{"name": "bad", "packages": {"default": ["--allow-unauthenticated"]}}]`,
+		`[{"name": "bad", "packages": {"apt": ["-oDebug::pkgProblemResolver=1"]}}]`,
+		`[{"name": "bad", "packages": {"default": ["nginx"]}, "services": ["--now"]}]`,
+	} {
+		if _, err := parseSoftwareCatalog([]byte(doc)); err == nil {
+			t.Errorf("catalog %s accepted", doc)
+		}
+	}
+}
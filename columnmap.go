@@ -0,0 +1,641 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const columnPresetsFile = "column_presets.json"
+
+// Rows of the import file shown on the preview page
+const previewRowLimit = 20
+
+// ImportField is a value an import row can supply, with the header names it
+// is recognised by. Headers are compared lowercased, keeping only letters and
+// digits, so "Reg. No" matches "regno".
+type ImportField struct {
+	Name    string
+	Label   string
+	Aliases []string
+}
+
+// importFields lists the fields of create imports; the account attributes
+// follow accountAttributeColumns
+var importFields = []ImportField{
+	{"username", "Username", []string{"username", "user", "login", "loginname", "userid", "account"}},
+	{"password", "Password", []string{"password", "pass", "passwd", "pwd"}},
+	{"name", "Name", []string{"name", "studentname", "student", "candidatename"}},
+	{"rollno", "Roll number", []string{"rollno", "rollnumber", "roll", "regno", "regnumber", "registrationno",
+		"registrationnumber", "enrollmentno", "enrollmentnumber", "enrolmentno", "admissionno", "studentid"}},
+	{"full_name", "Full name", []string{"fullname", "displayname"}},
+	{"primary_group", "Primary group", []string{"primarygroup"}},
+	{"groups", "Groups", []string{"groups", "secondarygroups", "extragroups"}},
+	{"shell", "Shell", []string{"shell", "loginshell"}},
+	{"home", "Home directory", []string{"home", "homedir", "homedirectory"}},
+	{"uid", "UID", []string{"uid"}},
+	{"gid", "GID", []string{"gid"}},
+	{"expires_on", "Expires on", []string{"expireson", "expires", "expiry", "expirydate", "expiration"}},
+	{"ssh_keys", "SSH keys", []string{"sshkeys", "sshkey", "publickey", "publickeys", "authorizedkeys"}},
+	{"quota", "Quota", []string{"quota", "diskquota"}},
+}
+
+// findImportField looks up an import field by name
+func findImportField(name string) (ImportField, bool) {
+	for _, field := range importFields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return ImportField{}, false
+}
+
+// normalizeHeader reduces a header cell to lowercase letters and digits
+func normalizeHeader(header string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(header) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ColumnMapping gives the import field of each column, "" for ignored ones
+type ColumnMapping []string
+
+// positionalMapping is the fixed layout of files without a header row:
+// username,password for CSV and name,rollno for Excel, followed by the
+// account attributes, and only the username for deletions
+func positionalMapping(kind string, columns int) ColumnMapping {
+	mapping := ColumnMapping{"username", "password"}
+	switch kind {
+	case "excel":
+		mapping = ColumnMapping{"name", "rollno"}
+	case "delete":
+		return ColumnMapping{"username"}.resize(columns)
+	}
+	mapping = append(mapping, accountAttributeColumns...)
+	return mapping.resize(columns)
+}
+
+// detectMapping maps header cells to fields through a preset, then the
+// field aliases, and counts the recognised columns. A field is only taken
+// by its first column.
+func detectMapping(header []string, preset *ColumnPreset) (ColumnMapping, int) {
+	mapping := make(ColumnMapping, len(header))
+	taken := make(map[string]bool)
+	matched := 0
+	for i, cell := range header {
+		key := normalizeHeader(cell)
+		if key == "" {
+			continue
+		}
+		field, ok := "", false
+		if preset != nil {
+			field, ok = preset.Columns[key]
+		}
+		if !ok {
+			for _, f := range importFields {
+				for _, alias := range f.Aliases {
+					if alias == key {
+						field, ok = f.Name, true
+					}
+				}
+				if ok {
+					break
+				}
+			}
+		}
+		if field != "" && !taken[field] {
+			mapping[i] = field
+			taken[field] = true
+			matched++
+		}
+	}
+	return mapping, matched
+}
+
+// resize pads or truncates a mapping to the given number of columns
+func (m ColumnMapping) resize(columns int) ColumnMapping {
+	resized := make(ColumnMapping, columns)
+	copy(resized, m)
+	return resized
+}
+
+// has reports whether a column is mapped to the field
+func (m ColumnMapping) has(field string) bool {
+	for _, f := range m {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the trimmed value of a field in a row
+func (m ColumnMapping) get(row []string, field string) string {
+	for i, f := range m {
+		if f == field && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+	}
+	return ""
+}
+
+// attributes returns the values of a row in accountAttributeColumns order,
+// as parseAccountAttributes expects them
+func (m ColumnMapping) attributes(row []string) []string {
+	values := make([]string, len(accountAttributeColumns))
+	for i, field := range accountAttributeColumns {
+		values[i] = m.get(row, field)
+	}
+	return values
+}
+
+// ImportTable is an uploaded import file read with its column mapping
+type ImportTable struct {
+	Kind     string
+	Filename string
+	Upload   *Upload
+	Sheets   []string
+	Sheet    string
+	Header   []string
+	Rows     [][]string
+	Columns  int
+	Mapping  ColumnMapping
+}
+
+// readImportTable reads an import file, freshly uploaded in field or kept
+// from a preview, and maps its columns. The header form value tells whether
+// the first row holds headers: "yes", "no" or "auto", which takes it as a
+// header when one of its cells names a field. Files without a recognised
+// header use the positional layout, and map_N values from the preview page
+// override the mapping of column N.
+func readImportTable(r *http.Request, field, kind string) (*ImportTable, error) {
+	table := &ImportTable{Kind: kind, Sheet: strings.TrimSpace(r.FormValue("sheet"))}
+
+	var err error
+	if name := r.FormValue("upload"); name != "" && !hasUpload(r, field) {
+		table.Upload, err = keptUpload(name, r.FormValue("upload_filename"))
+	} else {
+		table.Upload, err = receiveUpload(r, field)
+	}
+	if err != nil {
+		return nil, err
+	}
+	table.Filename = table.Upload.Filename
+
+	rows, sheets, err := readTableFile(table.Upload, table.Sheet)
+	if err != nil {
+		return nil, err
+	}
+	table.Sheets = sheets
+	if table.Sheet == "" && len(sheets) > 0 {
+		table.Sheet = sheets[0]
+	}
+	for _, row := range rows {
+		table.Columns = max(table.Columns, len(row))
+	}
+
+	var preset *ColumnPreset
+	if name := strings.TrimSpace(r.FormValue("column_preset")); name != "" {
+		p, ok := columnPresets[name]
+		if !ok {
+			return nil, fmt.Errorf("column preset %q not found", name)
+		}
+		preset = &p
+	}
+
+	headerMode := r.FormValue("header")
+	switch headerMode {
+	case "", "auto", "yes", "no":
+	default:
+		return nil, fmt.Errorf("unknown header mode %q", headerMode)
+	}
+
+	table.Rows = rows
+	if headerMode != "no" && len(rows) > 0 {
+		mapping, matched := detectMapping(rows[0], preset)
+		if matched > 0 || headerMode == "yes" {
+			table.Header, table.Rows = rows[0], rows[1:]
+		}
+		if matched > 0 {
+			table.Mapping = mapping.resize(table.Columns)
+		}
+	}
+	if table.Mapping == nil {
+		table.Mapping = positionalMapping(kind, table.Columns)
+	}
+
+	// Choices made on the preview page apply to the sheet they were made for
+	if r.FormValue("mapped_sheet") == table.Sheet && r.FormValue("mapped") != "" {
+		for i := range table.Mapping {
+			name := r.FormValue(fmt.Sprintf("map_%d", i))
+			if _, ok := findImportField(name); name != "" && !ok {
+				return nil, fmt.Errorf("unknown import field %q", name)
+			}
+			table.Mapping[i] = name
+		}
+	}
+
+	if !table.Mapping.has("username") && !table.Mapping.has("name") {
+		return table, fmt.Errorf("no column is mapped to the username or the name")
+	}
+	return table, nil
+}
+
+// ColumnNames returns the header of each column, or its number
+func (t *ImportTable) ColumnNames() []string {
+	names := make([]string, t.Columns)
+	for i := range names {
+		if i < len(t.Header) && strings.TrimSpace(t.Header[i]) != "" {
+			names[i] = strings.TrimSpace(t.Header[i])
+		} else {
+			names[i] = fmt.Sprintf("Column %d", i+1)
+		}
+	}
+	return names
+}
+
+// PreviewRows returns the first rows of the file, padded to every column
+func (t *ImportTable) PreviewRows() [][]string {
+	var rows [][]string
+	for _, row := range t.Rows[:min(len(t.Rows), previewRowLimit)] {
+		padded := make([]string, t.Columns)
+		copy(padded, row)
+		rows = append(rows, padded)
+	}
+	return rows
+}
+
+// accounts turns the rows of an import into accounts. The username column
+// wins; otherwise the username rule makes one from the name, numbered when
+// another row or another person on the server has it, and the name doubles
+// as the full name. Rows without a password get one from the policy, and
+// passwords from the file must be strong or already hashed. Skipped rows
+// and other findings are listed in the returned validation report.
+func (t *ImportTable) accounts(options importOptions, batch string) ([]UserAccount, *ValidationReport) {
+	report := newValidationReport(t.Filename, options.Server)
+	if options.Passwords == nil && !t.Mapping.has("password") {
+		report.add(0, "password", "", "no column is mapped to the password, choose a password policy", "error")
+		return nil, report
+	}
+
+	var accounts []UserAccount
+	usedOn := make(map[string]int)
+	for i, row := range t.Rows {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		line := t.rowNumber(i)
+		report.Rows++
+		skip := func(field, value string, err error) {
+			var fe *FieldError
+			if errors.As(err, &fe) {
+				field, value = fe.Field, fe.Value
+			}
+			report.add(line, t.columnName(field), value, err.Error(), "error")
+		}
+
+		name := t.Mapping.get(row, "name")
+		rollNo := t.Mapping.get(row, "rollno")
+		username := t.Mapping.get(row, "username")
+		password := t.Mapping.get(row, "password")
+		if username == "" && name == "" {
+			skip("username", "", fmt.Errorf("missing username or name"))
+			continue
+		}
+		if password == "" && options.Passwords == nil {
+			skip("password", "", fmt.Errorf("missing password"))
+			continue
+		}
+		if first, ok := usedOn[username]; ok {
+			skip("username", username, fmt.Errorf("duplicate within the file, first on row %d", first))
+			continue
+		}
+
+		originalName := ""
+		if username == "" {
+			base, err := options.Usernames.derive(name, rollNo)
+			if err == nil {
+				username, err = uniqueUsername(base, options.Usernames.maxLength(), func(candidate string) bool {
+					if _, ok := usedOn[candidate]; ok {
+						return true
+					}
+					stored, ok := findAccountIn(options.Existing, candidate)
+					return ok && !stored.samePerson(name, rollNo)
+				})
+			}
+			if err != nil {
+				skip("name", name, err)
+				continue
+			}
+			if username != base {
+				report.add(line, t.columnName("name"), name, fmt.Sprintf("%s is taken, using %s", base, username), "warning")
+			}
+			originalName = name
+		}
+
+		account := UserAccount{
+			Username:     username,
+			FullName:     name,
+			OriginalName: originalName,
+			RollNo:       rollNo,
+			Password:     password,
+			ExpiresOn:    options.ExpiresOn,
+			ImportBatch:  batch,
+			Quota:        options.Quota,
+		}
+		if err := parseAccountAttributes(&account, t.Mapping.attributes(row)); err != nil {
+			skip("", "", err)
+			continue
+		}
+		account.DeleteOnExpiry = options.DeleteOnExpiry && account.ExpiresOn != ""
+
+		// A password in the file wins over the policy but must be strong;
+		// pre-hashed passwords are taken as they are. The report never
+		// repeats a password.
+		var err error
+		switch {
+		case password == "":
+			account.Password, err = options.Passwords.generate(account)
+			if err != nil {
+				err = fmt.Errorf("password policy %s: %v", options.Passwords.Name, err)
+			}
+		case isCryptHash(password):
+		default:
+			if err = checkPasswordStrength(password, account); err != nil {
+				err = fmt.Errorf("weak password: %v", err)
+			}
+		}
+		if err != nil {
+			skip("password", "(hidden)", err)
+			continue
+		}
+
+		if _, ok := findAccountIn(options.Existing, account.Username); ok {
+			report.add(line, t.columnName("username"), account.Username,
+				fmt.Sprintf("user already exists, conflict policy: %s", conflictPolicies[options.Conflict]), "warning")
+		}
+		usedOn[account.Username] = line
+		accounts = append(accounts, account)
+	}
+
+	report.Valid = len(accounts)
+	return accounts, report
+}
+
+// rowNumber returns the line of the file a table row came from
+func (t *ImportTable) rowNumber(i int) int {
+	if len(t.Header) > 0 {
+		return i + 2
+	}
+	return i + 1
+}
+
+// columnName returns the column header a field is read from, or the
+// field's label when no column holds it
+func (t *ImportTable) columnName(field string) string {
+	if field == "" {
+		return ""
+	}
+	names := t.ColumnNames()
+	for i, f := range t.Mapping {
+		if f == field && i < len(names) {
+			return names[i]
+		}
+	}
+	if f, ok := findImportField(field); ok {
+		return f.Label
+	}
+	return field
+}
+
+// importOptions are the settings of an import form applied to every row,
+// and the accounts already stored for the server
+type importOptions struct {
+	Server    string
+	ExpiresOn string
+	// DeleteOnExpiry opts the imported accounts with an expiry date into
+	// deletion after the grace period
+	DeleteOnExpiry bool
+	Conflict       string
+	Quota          *Quota
+	Keys           map[string][]string
+	Passwords      *PasswordPolicy
+	Usernames      UsernameRule
+	Existing       []UserAccount
+}
+
+// readImportOptions reads the import settings of a form; fallbackPolicy is
+// the password policy used when the form names none
+func readImportOptions(r *http.Request, fallbackPolicy string) (importOptions, error) {
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	options := importOptions{
+		Server:    ip,
+		Usernames: appSettings.UsernameRule,
+		Existing:  ipMap[ip].Accounts,
+	}
+	var err error
+	if options.ExpiresOn, err = importExpiry(r); err != nil {
+		return options, err
+	}
+	options.DeleteOnExpiry = r.FormValue("delete_on_expiry") == "on"
+	if options.Conflict, err = conflictPolicy(r); err != nil {
+		return options, err
+	}
+	if options.Quota, err = formQuota(r); err != nil {
+		return options, err
+	}
+	if options.Keys, err = readKeyArchive(r, "keyszip"); err != nil {
+		return options, err
+	}
+	if options.Passwords, err = importPasswordPolicy(r, fallbackPolicy); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// ColumnPreset remembers how the headers of a recurring export map to
+// import fields, e.g. the registrar's "Student Name" and "Reg No"
+type ColumnPreset struct {
+	Name    string            `json:"name"`
+	Columns map[string]string `json:"columns"`
+}
+
+var columnPresets map[string]ColumnPreset
+
+func loadColumnPresets() error {
+	columnPresets = make(map[string]ColumnPreset)
+	data, err := os.ReadFile(columnPresetsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &columnPresets)
+}
+
+func saveColumnPresets() error {
+	data, err := json.MarshalIndent(columnPresets, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(columnPresetsFile, data, 0644)
+}
+
+// presetNames returns the column preset names in order
+func presetNames() []string {
+	var names []string
+	for name := range columnPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// saveColumnPreset stores the mapping of a table's header as a preset.
+// Ignored columns are kept too, so their header is not guessed next time.
+func saveColumnPreset(name string, table *ImportTable) error {
+	if len(table.Header) == 0 {
+		return fmt.Errorf("presets map header names, and this file has no header row")
+	}
+	preset := ColumnPreset{Name: name, Columns: make(map[string]string)}
+	for i, cell := range table.Header {
+		if key := normalizeHeader(cell); key != "" && i < len(table.Mapping) {
+			preset.Columns[key] = table.Mapping[i]
+		}
+	}
+	columnPresets[name] = preset
+	return saveColumnPresets()
+}
+
+// Form values of the import pages carried from the preview to the import
+var importFormFields = []string{"server_ip", "expires_on", "delete_on_expiry", "on_conflict", "password_policy",
+	"quota_block_soft", "quota_block_hard", "quota_inode_soft", "quota_inode_hard"}
+
+// importPreviewHandler shows how an uploaded file is read before anything
+// is imported, lets the sheet, header and column mapping be changed, and
+// can save the mapping as a preset
+func importPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind := r.FormValue("kind")
+	field, action, fallback := "csvfile", "/create-users", "file"
+	if kind == "excel" {
+		field, action, fallback = "excelfile", "/create-users-excel", defaultExcelPolicy
+	} else {
+		kind = "csv"
+	}
+
+	// The key archive is kept for the import the preview leads to
+	keysUpload := r.FormValue("keyszip_upload")
+	if hasUpload(r, "keyszip") {
+		upload, err := receiveUpload(r, "keyszip")
+		if err == nil {
+			err = upload.keep()
+		}
+		if err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		keysUpload = upload.Name
+	}
+
+	table, tableErr := readImportTable(r, field, kind)
+	if table == nil {
+		http.Error(w, "❌ "+tableErr.Error(), http.StatusBadRequest)
+		return
+	}
+	// and so is the import file, unless it was kept by an earlier preview
+	if table.Upload.Name == "" {
+		if err := table.Upload.keep(); err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var message string
+	if name := strings.TrimSpace(r.FormValue("save_preset")); name != "" {
+		if err := saveColumnPreset(name, table); err != nil {
+			message = "❌ " + err.Error()
+		} else {
+			message = fmt.Sprintf("✅ Column preset %q saved", name)
+		}
+	}
+
+	var accounts []UserAccount
+	var report *ValidationReport
+	var log string
+	options, err := readImportOptions(r, fallback)
+	switch {
+	case tableErr != nil:
+		log = "❌ " + tableErr.Error() + "\n"
+	case err != nil:
+		log = "❌ " + err.Error() + "\n"
+	default:
+		accounts, report = table.accounts(options, "")
+		if len(report.Issues) > 0 {
+			report.keep()
+		}
+		log = addArchiveKeys(accounts, options.Keys)
+	}
+
+	hidden := make(map[string]string)
+	for _, name := range importFormFields {
+		hidden[name] = r.FormValue(name)
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/import_preview.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Table":      table,
+		"Fields":     importFields,
+		"Presets":    presetNames(),
+		"Preset":     r.FormValue("column_preset"),
+		"HeaderMode": r.FormValue("header"),
+		"KeysUpload": keysUpload,
+		"Hidden":     hidden,
+		"Action":     action,
+		"Accounts":   accounts,
+		"Report":     report,
+		"Log":        log,
+		"Ready":      tableErr == nil && err == nil && len(accounts) > 0,
+		"Message":    message,
+	})
+}
+
+// columnPresetsHandler lists the saved column presets
+func columnPresetsHandler(w http.ResponseWriter, r *http.Request) {
+	var presets []ColumnPreset
+	for _, name := range presetNames() {
+		presets = append(presets, columnPresets[name])
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/column_presets.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Presets": presets,
+	})
+}
+
+// deleteColumnPresetHandler removes a column preset
+func deleteColumnPresetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	delete(columnPresets, strings.TrimSpace(r.FormValue("name")))
+	saveColumnPresets()
+	http.Redirect(w, r, "/imports/presets", http.StatusSeeOther)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credential handouts are kept in memory only, for at most this long
+const handoutLifetime = 24 * time.Hour
+
+// Pre-hashed passwords accepted in import files: SHA-256, SHA-512 and
+// yescrypt crypt(3) hashes
+var cryptHashPattern = regexp.MustCompile(`^\$(5|6|y)\$[./A-Za-z0-9$=,]+$`)
+
+// Credential is a username and its plaintext password
+type Credential struct {
+	Username string
+	Password string
+}
+
+// CredentialHandout holds the passwords set by one operation on a server
+// that keeps no plaintext, until they are downloaded once
+type CredentialHandout struct {
+	ID          string
+	Server      string
+	Title       string
+	Created     time.Time
+	Credentials []Credential
+}
+
+// handouts are guarded by storeMu and never written to disk
+var handouts = make(map[string]*CredentialHandout)
+
+// hashesPasswords reports whether a server keeps only password hashes,
+// either by its own setting or the global one
+func (server ServerInfo) hashesPasswords(settings Settings) bool {
+	return server.HashPasswords || settings.HashPasswords
+}
+
+// isCryptHash reports whether an imported password is already a crypt hash
+func isCryptHash(password string) bool {
+	return cryptHashPattern.MatchString(password)
+}
+
+// setPassword gives an account a new plaintext password, storing only its
+// hash when hashed is set
+func (account *UserAccount) setPassword(password string, hashed bool) {
+	if hashed {
+		account.Password, account.PasswordHash = "", hashPassword(password)
+	} else {
+		account.Password, account.PasswordHash = password, ""
+	}
+}
+
+// setImportedPassword gives an account a password read from an import file,
+// which may already be a crypt hash
+func (account *UserAccount) setImportedPassword(password string, hashed bool) {
+	if isCryptHash(password) {
+		account.Password, account.PasswordHash = "", password
+		return
+	}
+	account.setPassword(password, hashed)
+}
+
+// hasPassword reports whether a password or hash is stored for the account
+func (account UserAccount) hasPassword() bool {
+	return account.Password != "" || account.PasswordHash != ""
+}
+
+// passwordMatches checks a plaintext password against the stored password
+// or hash
+func (account UserAccount) passwordMatches(password string) bool {
+	if account.PasswordHash == "" {
+		return account.Password == password
+	}
+	ok, err := verifySHA512Crypt(account.PasswordHash, password)
+	return err == nil && ok
+}
+
+// importedPasswordMatches checks a password read from an import file, which
+// may be a crypt hash, against the stored password or hash
+func (account UserAccount) importedPasswordMatches(password string) bool {
+	if isCryptHash(password) {
+		return password == account.PasswordHash
+	}
+	return account.passwordMatches(password)
+}
+
+// passwordCommand sets an account's stored password on the host, sending
+// only the hash through chpasswd -e when no plaintext is kept
+func passwordCommand(rootPassword string, account UserAccount) string {
+	if account.PasswordHash == "" {
+		return chpasswdCommand(rootPassword, account.Username, account.Password)
+	}
+	return sudoInputCommand(rootPassword, "chpasswd -e", account.Username+":"+account.PasswordHash)
+}
+
+// hashStoredPasswords replaces the plaintext passwords stored for a server
+// by their hashes and returns how many were converted
+func (server *ServerInfo) hashStoredPasswords() int {
+	converted := 0
+	for i := range server.Accounts {
+		if server.Accounts[i].Password != "" {
+			server.Accounts[i].setPassword(server.Accounts[i].Password, true)
+			converted++
+		}
+	}
+	return converted
+}
+
+// newHandout keeps the credentials of an operation for a one-time download
+// and returns the log line pointing to it; storeMu must be held
+func newHandout(ip, title string, credentials []Credential) string {
+	if len(credentials) == 0 {
+		return ""
+	}
+	pruneHandouts(time.Now())
+	handout := &CredentialHandout{
+		ID:          newID(),
+		Server:      ip,
+		Title:       title,
+		Created:     time.Now(),
+		Credentials: credentials,
+	}
+	handouts[handout.ID] = handout
+	return fmt.Sprintf("\n🔐 Passwords are not stored for %s. Download the %d new passwords once from the Handouts page (/handouts) within %s.\n",
+		ip, len(credentials), handoutLifetime)
+}
+
+// pruneHandouts drops handouts older than handoutLifetime
+func pruneHandouts(now time.Time) {
+	for id, handout := range handouts {
+		if now.Sub(handout.Created) > handoutLifetime {
+			delete(handouts, id)
+		}
+	}
+}
+
+// handoutsHandler lists the credential handouts waiting to be downloaded
+func handoutsHandler(w http.ResponseWriter, r *http.Request) {
+	pruneHandouts(time.Now())
+	var list []*CredentialHandout
+	for _, handout := range handouts {
+		list = append(list, handout)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created.After(list[j].Created)
+	})
+
+	tmpl := template.Must(template.ParseFiles("templates/handouts.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Handouts": list,
+		"Lifetime": handoutLifetime,
+	})
+}
+
+// downloadHandoutHandler serves a handout as CSV and forgets it
+func downloadHandoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handout, ok := handouts[r.FormValue("id")]
+	if !ok {
+		http.Error(w, "Handout not found; it was already downloaded or has expired", http.StatusNotFound)
+		return
+	}
+	delete(handouts, handout.ID)
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=credentials_%s_%s.csv",
+		handout.Server, handout.Created.Format("20060102-150405")))
+	w.Header().Set("Cache-Control", "no-store")
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Username", "Password", "Server"})
+	for _, credential := range handout.Credentials {
+		writer.Write([]string{credential.Username, credential.Password, handout.Server})
+	}
+	writer.Flush()
+}
+
+// passwordStorageHandler switches plaintext password storage off or on,
+// globally or for one server. Switching it off hashes the passwords stored
+// so far.
+func passwordStorageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	if server, ok := ipMap[ip]; ok {
+		server.HashPasswords = r.FormValue("server_hash_passwords") == "on"
+		ipMap[ip] = server
+	}
+	appSettings.HashPasswords = r.FormValue("hash_passwords") == "on"
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var logBuilder strings.Builder
+	for serverIP, server := range ipMap {
+		if !server.hashesPasswords(appSettings) {
+			continue
+		}
+		if n := server.hashStoredPasswords(); n > 0 {
+			logBuilder.WriteString(fmt.Sprintf("🔐 %s: %d stored passwords replaced by their hashes\n", serverIP, n))
+		}
+		ipMap[serverIP] = server
+	}
+	saveIPMap()
+
+	if logBuilder.Len() == 0 {
+		logBuilder.WriteString("✅ Password storage settings saved.\n")
+	}
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// verifyPasswordHandler checks a password a user reports against the stored
+// password or hash, without contacting the server
+func verifyPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	account, found := server.findAccount(username)
+
+	var result string
+	switch {
+	case !found:
+		result = fmt.Sprintf("❌ %s is not a managed account\n", username)
+	case !account.hasPassword():
+		result = fmt.Sprintf("⚠️ No password is recorded for %s\n", username)
+	case account.PasswordHash != "" && !strings.HasPrefix(account.PasswordHash, "$6$"):
+		result = fmt.Sprintf("⚠️ The hash stored for %s was imported pre-hashed and cannot be checked here\n", username)
+	case account.passwordMatches(r.FormValue("password")):
+		result = fmt.Sprintf("✅ The password matches the one recorded for %s\n", username)
+	default:
+		result = fmt.Sprintf("❌ The password does not match the one recorded for %s\n", username)
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, result)
+}
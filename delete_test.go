@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestDeleteUsernamesExcelLayout(t *testing.T) {
+	f := excelize.NewFile()
+	rows := [][]interface{}{
+		{"Name", "Roll No"},
+		{"John Doe", 101},
+		{"Mary Major", 102},
+		{"alex", 103},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow("Sheet1", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var file bytes.Buffer
+	if err := f.Write(&file); err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("excelfile", "students.xlsx")
+	part.Write(file.Bytes())
+	form.Close()
+	r := httptest.NewRequest("POST", "/delete-users-excel", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+
+	// Usernames derived at import are found through the roll number or the
+	// imported name; rows matching no account fall back to the first column
+	accounts := []UserAccount{
+		{Username: "jdoe", OriginalName: "John Doe", RollNo: "101"},
+		{Username: "mmajor", OriginalName: "Mary Major", RollNo: "102"},
+	}
+	usernames, skipped, err := deleteUsernames(r, "excelfile", accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"jdoe", "mmajor", "alex"}; !slices.Equal(usernames, want) {
+		t.Errorf("deleteUsernames = %v, want %v (skipped: %q)", usernames, want, skipped)
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How often the scheduler looks for accounts to remind, lock or delete
+const expiryCheckInterval = time.Hour
+
+// Name of the reminder notice left in a user's home directory
+const expiryNoticeFile = "ACCOUNT_EXPIRY_NOTICE.txt"
+
+// lastSweep records when the scheduler last ran and what it did; it is
+// guarded by storeMu
+var lastSweep struct {
+	Time    time.Time
+	Log     string
+	Running bool
+}
+
+// importBatch names the batch of accounts created by one import
+func importBatch(filename string) string {
+	return time.Now().Format("2006-01-02 15:04") + " " + filename
+}
+
+// importExpiry reads the optional expiry date applied to a whole import
+func importExpiry(r *http.Request) (string, error) {
+	return parseExpiryDate(r.FormValue("expires_on"))
+}
+
+// deletesOnExpiry reports whether the scheduler deletes an account after
+// its grace period: auto-deletion must be on and the account's expiry must
+// have opted into it
+func (account UserAccount) deletesOnExpiry(settings Settings) bool {
+	return settings.ExpiryAutoDelete && account.DeleteOnExpiry
+}
+
+// expiryDates returns the day an account is locked and the day it is deleted
+func (account UserAccount) expiryDates(settings Settings) (expires, deleteOn time.Time, ok bool) {
+	if account.ExpiresOn == "" {
+		return time.Time{}, time.Time{}, false
+	}
+	expires, err := time.ParseInLocation(dateLayout, account.ExpiresOn, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return expires, expires.AddDate(0, 0, settings.ExpiryGraceDays), true
+}
+
+// expiryAction decides what the scheduler does with an account today:
+// "remind", "lock", "delete" or nothing
+func expiryAction(account UserAccount, settings Settings, now time.Time) string {
+	expires, deleteOn, ok := account.expiryDates(settings)
+	if !ok {
+		return ""
+	}
+	switch {
+	case account.deletesOnExpiry(settings) && !now.Before(deleteOn):
+		return "delete"
+	case !now.Before(expires):
+		if !account.Locked {
+			return "lock"
+		}
+	case settings.ExpiryReminderDays > 0 && account.RemindedOn == "" &&
+		!now.Before(expires.AddDate(0, 0, -settings.ExpiryReminderDays)):
+		return "remind"
+	}
+	return ""
+}
+
+// expiryNotice is the text of the reminder left for a user
+func expiryNotice(account UserAccount, settings Settings) string {
+	_, deleteOn, _ := account.expiryDates(settings)
+	notice := fmt.Sprintf("Your account %s expires on %s and will be locked on that day.", account.Username, account.ExpiresOn)
+	if account.deletesOnExpiry(settings) {
+		notice += fmt.Sprintf(" The account and its home directory will be deleted on %s.", deleteOn.Format(dateLayout))
+	}
+	return notice + " Please copy any work you want to keep before then."
+}
+
+// expiryCommand builds the remote command for a scheduler action. The
+// reminder is written by the user, not root, so a symlink the user planted
+// in their home directory cannot redirect the write to another file.
+func expiryCommand(rootPassword string, account UserAccount, action string, settings Settings) string {
+	switch action {
+	case "remind":
+		script := `h=$(getent passwd "$1" | cut -d: -f6) && [ -d "$h" ] && printf '%s\n' "$2" > "$h/` + expiryNoticeFile + `"`
+		return sudoCommand(rootPassword, "-u "+shellQuote(account.Username)+" sh -c "+shellQuote(script)+
+			" sh "+shellQuote(account.Username)+" "+shellQuote(expiryNotice(account, settings)))
+	case "lock":
+		return accountActionCommand(rootPassword, account, AccountAction{Username: account.Username, Action: "lock"})
+	case "delete":
+		return sudoCommand(rootPassword, "userdel -r "+shellQuote(account.Username))
+	}
+	return ""
+}
+
+// startExpiryScheduler runs the expiry sweep now and then every
+// expiryCheckInterval in the background
+func startExpiryScheduler() {
+	go func() {
+		for {
+			runExpirySweep(time.Now())
+			time.Sleep(expiryCheckInterval)
+		}
+	}()
+}
+
+// runExpirySweep reminds, locks and deletes expiring accounts on every
+// server. The store is only locked while reading and updating it, not while
+// the remote commands run.
+func runExpirySweep(now time.Time) {
+	storeMu.Lock()
+	if lastSweep.Running {
+		storeMu.Unlock()
+		return
+	}
+	lastSweep.Running = true
+	settings := appSettings
+	servers := make(map[string]ServerInfo, len(ipMap))
+	var ips []string
+	for ip, server := range ipMap {
+		server.Accounts = slices.Clone(server.Accounts)
+		servers[ip] = server
+		ips = append(ips, ip)
+	}
+	storeMu.Unlock()
+	sort.Strings(ips)
+
+	var logBuilder strings.Builder
+	for _, ip := range ips {
+		server := servers[ip]
+
+		var script strings.Builder
+		actions := make(map[string]string)
+		for _, account := range server.Accounts {
+			action := expiryAction(account, settings, now)
+			if action == "" {
+				continue
+			}
+			if action == "delete" && archivePath(settings, account.Username) == "" && !settings.ExpiryDeleteWithoutArchive {
+				logBuilder.WriteString(fmt.Sprintf("⏸️ %s: %s is due for deletion but home directories are not archived; turn on archiving or allow deletion without an archive\n",
+					ip, account.Username))
+				continue
+			}
+			actions[account.Username] = action
+			if action == "delete" {
+				script.WriteString(deleteUserScript(server.RootPassword, account.Username, archivePath(settings, account.Username)))
+				continue
+			}
+			script.WriteString(markResult(account.Username+":"+action, expiryCommand(server.RootPassword, account, action, settings)))
+		}
+		if len(actions) == 0 {
+			continue
+		}
+
+		output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script.String())
+		if err != nil {
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: remote script execution failed: %v\n", ip, err))
+		}
+		results, _ := parseResults(output)
+
+		// Catalog the archives of deleted users before taking the lock,
+		// as copying them back can take a while
+		server.Archives = nil
+		for _, line := range strings.SplitAfter(catalogArchives(ip, &server, results, settings), "\n") {
+			if line != "" {
+				logBuilder.WriteString(ip + ": " + line)
+			}
+		}
+		homeArchives := server.Archives
+		for username, ok := range deletedUsers(results) {
+			results[username+":delete"] = ok
+		}
+
+		storeMu.Lock()
+		s, ok := ipMap[ip]
+		if ok {
+			var kept []UserAccount
+			for _, account := range s.Accounts {
+				action, planned := actions[account.Username]
+				if !planned {
+					kept = append(kept, account)
+					continue
+				}
+				if !results[account.Username+":"+action] {
+					logBuilder.WriteString(fmt.Sprintf("❌ %s: %s %s failed\n", ip, action, account.Username))
+					kept = append(kept, account)
+					continue
+				}
+				switch action {
+				case "remind":
+					account.RemindedOn = now.Format(dateLayout)
+					logBuilder.WriteString(fmt.Sprintf("📬 %s: reminded %s of expiry on %s\n", ip, account.Username, account.ExpiresOn))
+				case "lock":
+					account.Locked = true
+					logBuilder.WriteString(fmt.Sprintf("🔒 %s: locked expired account %s\n", ip, account.Username))
+				case "delete":
+					logBuilder.WriteString(fmt.Sprintf("🗑️ %s: deleted %s after the grace period\n", ip, account.Username))
+					continue
+				}
+				kept = append(kept, account)
+			}
+			s.Accounts = kept
+			s.Archives = append(s.Archives, homeArchives...)
+			ipMap[ip] = s
+			saveIPMap()
+		}
+		storeMu.Unlock()
+	}
+
+	if logBuilder.Len() == 0 {
+		logBuilder.WriteString("✅ Nothing to do.\n")
+	} else {
+		log.Print("Expiry sweep:\n" + logBuilder.String())
+	}
+
+	storeMu.Lock()
+	lastSweep.Time = now
+	lastSweep.Log = logBuilder.String()
+	lastSweep.Running = false
+	storeMu.Unlock()
+}
+
+// ExpiryEntry is one account on the expiry calendar
+type ExpiryEntry struct {
+	Server   string
+	Account  UserAccount
+	DeleteOn string
+}
+
+// ExpiryDay lists the accounts expiring on one day
+type ExpiryDay struct {
+	Date    string
+	Weekday string
+	Past    bool
+	Entries []ExpiryEntry
+}
+
+// ExpiryMonth groups the expiry days of one month
+type ExpiryMonth struct {
+	Month string
+	Days  []ExpiryDay
+}
+
+// ImportBatchInfo summarises the accounts of one import batch on a server
+type ImportBatchInfo struct {
+	Server    string
+	Batch     string
+	Accounts  int
+	ExpiresOn string
+}
+
+// expiryCalendar groups all accounts with an expiry date by month and day
+func expiryCalendar(settings Settings, now time.Time) []ExpiryMonth {
+	days := make(map[string]*ExpiryDay)
+	for ip, server := range ipMap {
+		for _, account := range server.Accounts {
+			expires, deleteOn, ok := account.expiryDates(settings)
+			if !ok {
+				continue
+			}
+			day, found := days[account.ExpiresOn]
+			if !found {
+				day = &ExpiryDay{
+					Date:    account.ExpiresOn,
+					Weekday: expires.Weekday().String(),
+					Past:    !now.Before(expires),
+				}
+				days[account.ExpiresOn] = day
+			}
+			entry := ExpiryEntry{Server: ip, Account: account}
+			if account.deletesOnExpiry(settings) {
+				entry.DeleteOn = deleteOn.Format(dateLayout)
+			}
+			day.Entries = append(day.Entries, entry)
+		}
+	}
+
+	var dates []string
+	for date, day := range days {
+		dates = append(dates, date)
+		sort.Slice(day.Entries, func(i, j int) bool {
+			if day.Entries[i].Server != day.Entries[j].Server {
+				return day.Entries[i].Server < day.Entries[j].Server
+			}
+			return day.Entries[i].Account.Username < day.Entries[j].Account.Username
+		})
+	}
+	sort.Strings(dates)
+
+	var months []ExpiryMonth
+	for _, date := range dates {
+		t, _ := time.Parse(dateLayout, date)
+		month := t.Format("January 2006")
+		if len(months) == 0 || months[len(months)-1].Month != month {
+			months = append(months, ExpiryMonth{Month: month})
+		}
+		months[len(months)-1].Days = append(months[len(months)-1].Days, *days[date])
+	}
+	return months
+}
+
+// importBatches lists the import batches of all servers
+func importBatches() []ImportBatchInfo {
+	byKey := make(map[[2]string]*ImportBatchInfo)
+	var batches []*ImportBatchInfo
+	for ip, server := range ipMap {
+		for _, account := range server.Accounts {
+			if account.ImportBatch == "" {
+				continue
+			}
+			key := [2]string{ip, account.ImportBatch}
+			info, ok := byKey[key]
+			if !ok {
+				info = &ImportBatchInfo{Server: ip, Batch: account.ImportBatch, ExpiresOn: account.ExpiresOn}
+				byKey[key] = info
+				batches = append(batches, info)
+			}
+			info.Accounts++
+			if info.ExpiresOn != account.ExpiresOn {
+				info.ExpiresOn = "mixed"
+			}
+		}
+	}
+
+	sort.Slice(batches, func(i, j int) bool {
+		if batches[i].Batch != batches[j].Batch {
+			return batches[i].Batch > batches[j].Batch
+		}
+		return batches[i].Server < batches[j].Server
+	})
+	result := make([]ImportBatchInfo, len(batches))
+	for i, info := range batches {
+		result[i] = *info
+	}
+	return result
+}
+
+// expirationsHandler shows the expiry calendar, import batches and the
+// scheduler settings
+func expirationsHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	tmpl := template.Must(template.ParseFiles("templates/expirations.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Settings":  appSettings,
+		"Months":    expiryCalendar(appSettings, now),
+		"Batches":   importBatches(),
+		"LastSweep": lastSweep,
+		"Today":     now.Format(dateLayout),
+		"Message":   r.URL.Query().Get("message"),
+	})
+}
+
+// expirySettingsHandler updates the grace period and reminder settings
+func expirySettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	grace, err := strconv.Atoi(strings.TrimSpace(r.FormValue("grace_days")))
+	if err != nil || grace < 0 {
+		http.Error(w, "❌ Grace period must be a number of days", http.StatusBadRequest)
+		return
+	}
+	reminder, err := strconv.Atoi(strings.TrimSpace(r.FormValue("reminder_days")))
+	if err != nil || reminder < 0 {
+		http.Error(w, "❌ Reminder must be a number of days", http.StatusBadRequest)
+		return
+	}
+
+	appSettings.ExpiryGraceDays = grace
+	appSettings.ExpiryReminderDays = reminder
+	appSettings.ExpiryAutoDelete = r.FormValue("auto_delete") == "on"
+	appSettings.ExpiryDeleteWithoutArchive = r.FormValue("delete_without_archive") == "on"
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/expirations?message=Settings+saved", http.StatusSeeOther)
+}
+
+// expireBatchHandler sets or clears the expiry date of every account of an
+// import batch on a server
+func expireBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	expiresOn, err := parseExpiryDate(r.FormValue("expires_on"))
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch := r.FormValue("batch")
+	deleteOnExpiry := r.FormValue("delete_on_expiry") == "on"
+	var actions []AccountAction
+	for _, account := range server.Accounts {
+		if account.ImportBatch == batch {
+			actions = append(actions, AccountAction{Username: account.Username, Action: "expire", ExpiresOn: expiresOn,
+				DeleteOnExpiry: &deleteOnExpiry})
+		}
+	}
+	if len(actions) == 0 {
+		http.Error(w, "❌ No accounts in this import batch", http.StatusBadRequest)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, applyAccountActions(ip, actions))
+}
+
+// runExpirySweepHandler starts an expiry sweep right away. The sweep runs in
+// the background because it takes the store lock itself.
+func runExpirySweepHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	go runExpirySweep(time.Now())
+	http.Redirect(w, r, "/expirations?message=Expiry+check+started", http.StatusSeeOther)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Sheet names cannot hold these characters and are at most 31 long
+var sheetNameReplacer = strings.NewReplacer(":", "_", "\\", "_", "/", "_", "?", "_", "*", "_", "[", "_", "]", "_")
+
+// accountNotes sums up the state of an account for the Notes column
+func accountNotes(account UserAccount) string {
+	var notes []string
+	if account.Password == "" && account.PasswordHash != "" {
+		notes = append(notes, "password stored as a hash only")
+	}
+	if account.Locked {
+		notes = append(notes, "locked")
+	}
+	if account.ExpiresOn != "" {
+		notes = append(notes, "expires "+account.ExpiresOn)
+	}
+	if account.Quota != nil {
+		notes = append(notes, "quota "+account.Quota.String())
+	}
+	return strings.Join(notes, "; ")
+}
+
+// exportAccounts writes the accounts of the given servers as CSV, or as an
+// XLSX workbook encrypted with password when one is given
+func exportAccounts(w http.ResponseWriter, ips []string, format, password, base string) {
+	timestamp := time.Now().Format("20060102-150405")
+	if format != "xlsx" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s_%s.csv", base, timestamp))
+		writeAccountsCSV(w, ips)
+		return
+	}
+
+	f, err := accountsWorkbook(ips)
+	if err != nil {
+		http.Error(w, "Error creating workbook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s_%s.xlsx", base, timestamp))
+	f.Write(w, excelize.Options{Password: password})
+}
+
+// writeAccountsCSV writes one row per account of the given servers
+func writeAccountsCSV(w io.Writer, ips []string) {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	writer.Write([]string{"Username", "Password", "Server IP", "Notes"})
+	for _, ip := range ips {
+		for _, account := range ipMap[ip].Accounts {
+			writer.Write([]string{account.Username, account.Password, ip, accountNotes(account)})
+		}
+	}
+}
+
+// accountsWorkbook builds a workbook with a summary sheet and one sheet of
+// accounts per server. Headers are styled, frozen and filterable.
+func accountsWorkbook(ips []string) (*excelize.File, error) {
+	f := excelize.NewFile()
+	header, err := f.NewStyle(&excelize.Style{
+		Font:   &excelize.Font{Bold: true, Color: "FFFFFF"},
+		Fill:   excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"337AB7"}},
+		Border: []excelize.Border{{Type: "bottom", Color: "1F4E79", Style: 2}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	total, err := f.NewStyle(&excelize.Style{
+		Font:   &excelize.Font{Bold: true},
+		Border: []excelize.Border{{Type: "top", Color: "000000", Style: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	link, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Color: "337AB7", Underline: "single"}})
+	if err != nil {
+		return nil, err
+	}
+
+	summary := "Summary"
+	f.SetSheetName(f.GetSheetName(0), summary)
+	summaryHeader := []string{"Server", "Server Group", "OS", "Accounts", "Locked", "Hashed Only", "Expiring"}
+	writeHeaderRow(f, summary, summaryHeader, header)
+	f.SetColWidth(summary, "A", "C", 20)
+	f.SetColWidth(summary, "D", "G", 12)
+
+	used := map[string]bool{strings.ToLower(summary): true}
+	totals := make([]int, 4)
+	for i, ip := range ips {
+		server := ipMap[ip]
+		sheet := uniqueSheetName(ip, used)
+		if _, err := f.NewSheet(sheet); err != nil {
+			return nil, err
+		}
+
+		accountHeader := []string{"Username", "Password", "Full Name", "Roll No", "Groups", "Import Batch", "Notes"}
+		writeHeaderRow(f, sheet, accountHeader, header)
+		counts := make([]int, 4)
+		for j, account := range server.Accounts {
+			cell, _ := excelize.CoordinatesToCellName(1, j+2)
+			f.SetSheetRow(sheet, cell, &[]interface{}{account.Username, account.Password, account.FullName,
+				account.RollNo, strings.Join(account.Groups, ";"), account.ImportBatch, accountNotes(account)})
+			counts[0]++
+			if account.Locked {
+				counts[1]++
+			}
+			if account.Password == "" && account.PasswordHash != "" {
+				counts[2]++
+			}
+			if account.ExpiresOn != "" {
+				counts[3]++
+			}
+		}
+		f.SetColWidth(sheet, "A", "D", 18)
+		f.SetColWidth(sheet, "E", "F", 24)
+		f.SetColWidth(sheet, "G", "G", 40)
+		f.SetPanes(sheet, &excelize.Panes{Freeze: true, XSplit: 1, YSplit: 1, TopLeftCell: "B2", ActivePane: "bottomRight"})
+		if len(server.Accounts) > 0 {
+			last, _ := excelize.CoordinatesToCellName(len(accountHeader), len(server.Accounts)+1)
+			f.AutoFilter(sheet, "A1:"+last, nil)
+		}
+
+		row := i + 2
+		cell, _ := excelize.CoordinatesToCellName(1, row)
+		f.SetSheetRow(summary, cell, &[]interface{}{ip, server.ServerGroup, server.OSName,
+			counts[0], counts[1], counts[2], counts[3]})
+		f.SetCellHyperLink(summary, cell, fmt.Sprintf("'%s'!A1", sheet), "Location")
+		f.SetCellStyle(summary, cell, cell, link)
+		for k := range totals {
+			totals[k] += counts[k]
+		}
+	}
+
+	row := len(ips) + 2
+	cell, _ := excelize.CoordinatesToCellName(1, row)
+	last, _ := excelize.CoordinatesToCellName(len(summaryHeader), row)
+	f.SetSheetRow(summary, cell, &[]interface{}{"Total", "", "", totals[0], totals[1], totals[2], totals[3]})
+	f.SetCellStyle(summary, cell, last, total)
+	f.SetPanes(summary, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+	f.SetActiveSheet(0)
+	return f, nil
+}
+
+// writeHeaderRow writes and styles the first row of a sheet
+func writeHeaderRow(f *excelize.File, sheet string, header []string, style int) {
+	f.SetSheetRow(sheet, "A1", &header)
+	last, _ := excelize.CoordinatesToCellName(len(header), 1)
+	f.SetCellStyle(sheet, "A1", last, style)
+}
+
+// uniqueSheetName turns a server address into a valid sheet name not used
+// yet, ignoring case as spreadsheet programs do
+func uniqueSheetName(ip string, used map[string]bool) string {
+	base := sheetNameReplacer.Replace(strings.Trim(ip, "'"))
+	if base == "" {
+		base = "Server"
+	}
+	if len(base) > 31 {
+		base = base[:31]
+	}
+	name := base
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		name = base[:min(len(base), 31-len(suffix))] + suffix
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// sortedIPs returns the servers in address order, as export sheets are
+func sortedIPs() []string {
+	ips := make([]string, 0, len(ipMap))
+	for ip := range ipMap {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// exportHandler shows the export form; the export itself is posted to the
+// download handlers so the workbook password stays out of the URL
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/export.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"IPs": sortedIPs(),
+	})
+}
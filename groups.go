@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GroupInfo is a Linux group managed on a server. Membership is recorded
+// on each UserAccount's Groups.
+type GroupInfo struct {
+	Name      string `json:"name"`
+	GID       int    `json:"gid,omitempty"`
+	SharedDir string `json:"shared_dir,omitempty"`
+}
+
+// Default parent of group shared directories
+const sharedDirRoot = "/srv/groups"
+
+// findGroup returns the index of a group on the server, or -1
+func (server ServerInfo) findGroup(name string) int {
+	for i, group := range server.Groups {
+		if group.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// registerGroups records groups created as a side effect of account creation
+func (server *ServerInfo) registerGroups(names ...string) {
+	for _, name := range names {
+		if name != "" && server.findGroup(name) < 0 {
+			server.Groups = append(server.Groups, GroupInfo{Name: name})
+		}
+	}
+}
+
+// GroupMembers returns the managed accounts that belong to a group
+func (server ServerInfo) GroupMembers(name string) []string {
+	var members []string
+	for _, account := range server.Accounts {
+		if account.PrimaryGroup == name || account.inGroup(name) {
+			members = append(members, account.Username)
+		}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// inGroup reports whether the account lists the group as a supplementary group
+func (account UserAccount) inGroup(name string) bool {
+	for _, group := range account.Groups {
+		if group == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setMembership adds or removes a supplementary group on a stored account;
+// it returns false if the user is not managed on this server
+func (server *ServerInfo) setMembership(username, group string, member bool) bool {
+	for i, account := range server.Accounts {
+		if account.Username != username {
+			continue
+		}
+		var groups []string
+		for _, g := range account.Groups {
+			if g != group {
+				groups = append(groups, g)
+			}
+		}
+		if member {
+			groups = append(groups, group)
+		}
+		server.Accounts[i].Groups = groups
+		return true
+	}
+	return false
+}
+
+// groupsHandler shows the groups of a server and their members
+func groupsHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		tmpl := template.Must(template.ParseFiles("templates/groups.html"))
+		tmpl.Execute(w, map[string]interface{}{"Servers": ipMap})
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/groups.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Servers":       ipMap,
+		"IP":            ip,
+		"Server":        server,
+		"SharedDirRoot": sharedDirRoot,
+	})
+}
+
+// createGroupHandler creates a group on a server, optionally with a shared directory
+func createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	group := GroupInfo{Name: strings.TrimSpace(r.FormValue("name"))}
+	if !groupNamePattern.MatchString(group.Name) {
+		http.Error(w, fmt.Sprintf("❌ Invalid group name %q", group.Name), http.StatusBadRequest)
+		return
+	}
+	if gid := strings.TrimSpace(r.FormValue("gid")); gid != "" {
+		n, err := strconv.Atoi(gid)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("❌ Invalid GID %q", gid), http.StatusBadRequest)
+			return
+		}
+		group.GID = n
+	}
+	if r.FormValue("shared_dir") == "on" {
+		group.SharedDir = strings.TrimSpace(r.FormValue("shared_dir_path"))
+		if group.SharedDir == "" {
+			group.SharedDir = path.Join(sharedDirRoot, group.Name)
+		}
+		if !homePattern.MatchString(group.SharedDir) || path.Clean(group.SharedDir) != group.SharedDir {
+			http.Error(w, fmt.Sprintf("❌ Shared directory %q must be a clean absolute path", group.SharedDir), http.StatusBadRequest)
+			return
+		}
+	}
+
+	groupadd := "groupadd " + group.Name
+	if group.GID > 0 {
+		groupadd = fmt.Sprintf("groupadd -g %d %s", group.GID, group.Name)
+	}
+	script := sudoCommand(server.RootPassword, groupadd)
+	if group.SharedDir != "" {
+		dir := shellQuote(group.SharedDir)
+		script += " && " + sudoCommand(server.RootPassword, "sh -c "+shellQuote(
+			fmt.Sprintf("mkdir -p %s && chgrp %s %s && chmod 2770 %s", dir, group.Name, dir, dir)))
+	}
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(fmt.Sprintf("👥 Creating group %s on %s\n\n", group.Name, ip))
+
+	output, err := runRemoteUnlocked(ip, server, script+"\n")
+	logBuilder.WriteString(output)
+	server, ok = ipMap[ip]
+	switch {
+	case err != nil:
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	case !ok:
+		logBuilder.WriteString(serverRemovedLog)
+	default:
+		if i := server.findGroup(group.Name); i >= 0 {
+			server.Groups[i] = group
+		} else {
+			server.Groups = append(server.Groups, group)
+		}
+		ipMap[ip] = server
+		saveIPMap()
+		logBuilder.WriteString(fmt.Sprintf("✅ Group %s created\n", group.Name))
+		if group.SharedDir != "" {
+			logBuilder.WriteString(fmt.Sprintf("📁 Shared directory %s (setgid, mode 2770)\n", group.SharedDir))
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// deleteGroupHandler deletes a group from a server, optionally removing its shared directory
+func deleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if !groupNamePattern.MatchString(name) {
+		http.Error(w, fmt.Sprintf("❌ Invalid group name %q", name), http.StatusBadRequest)
+		return
+	}
+
+	script := sudoCommand(server.RootPassword, "groupdel "+name)
+	var sharedDir string
+	if i := server.findGroup(name); i >= 0 && r.FormValue("remove_shared_dir") == "on" {
+		sharedDir = server.Groups[i].SharedDir
+	}
+	if sharedDir != "" {
+		script += " && " + sudoCommand(server.RootPassword, "rm -rf "+shellQuote(sharedDir))
+	}
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString(fmt.Sprintf("🗑️ Deleting group %s from %s\n\n", name, ip))
+
+	output, err := runRemoteUnlocked(ip, server, script+"\n")
+	logBuilder.WriteString(output)
+	server, ok = ipMap[ip]
+	switch {
+	case err != nil:
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	case !ok:
+		logBuilder.WriteString(serverRemovedLog)
+	default:
+		if i := server.findGroup(name); i >= 0 {
+			server.Groups = append(server.Groups[:i], server.Groups[i+1:]...)
+		}
+		for _, member := range server.GroupMembers(name) {
+			server.setMembership(member, name, false)
+		}
+		ipMap[ip] = server
+		saveIPMap()
+		logBuilder.WriteString(fmt.Sprintf("✅ Group %s deleted\n", name))
+		if sharedDir != "" {
+			logBuilder.WriteString(fmt.Sprintf("📁 Removed shared directory %s\n", sharedDir))
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// groupMembersHandler adds or removes members of a group
+func groupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	if _, ok := ipMap[ip]; !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	group := strings.TrimSpace(r.FormValue("group"))
+	member := r.FormValue("action") != "remove"
+
+	usernames := r.Form["usernames"]
+	usernames = append(usernames, strings.Fields(strings.ReplaceAll(r.FormValue("usernames_text"), ",", " "))...)
+
+	var assignments [][2]string
+	for _, username := range usernames {
+		assignments = append(assignments, [2]string{strings.TrimSpace(username), group})
+	}
+
+	logs := applyGroupMembership(ip, assignments, member)
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logs)
+}
+
+// bulkGroupsHandler assigns users to groups from an uploaded CSV or Excel
+// file with username and group columns
+func bulkGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	if _, ok := ipMap[ip]; !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := readUploadedRows(r, "groupfile")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var assignments [][2]string
+	var skipped strings.Builder
+	for _, row := range rows {
+		if len(row) < 2 || strings.TrimSpace(row[0]) == "" || strings.TrimSpace(row[1]) == "" {
+			skipped.WriteString(fmt.Sprintf("❌ Skipped invalid row: %v\n", row))
+			continue
+		}
+		for _, group := range splitGroups(row[1]) {
+			assignments = append(assignments, [2]string{strings.TrimSpace(row[0]), group})
+		}
+	}
+
+	logs := skipped.String() + applyGroupMembership(ip, assignments, true)
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logs)
+}
+
+// applyGroupMembership adds (or removes) username/group pairs on a server,
+// creating missing groups when adding, and records the results in the store
+func applyGroupMembership(ip string, assignments [][2]string, member bool) string {
+	server := ipMap[ip]
+
+	var logBuilder strings.Builder
+	var script strings.Builder
+	var valid [][2]string
+	newGroups := make(map[string]bool)
+
+	for _, a := range assignments {
+		username, group := a[0], a[1]
+		if !usernamePattern.MatchString(username) {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped invalid username %q\n", username))
+			continue
+		}
+		if !groupNamePattern.MatchString(group) {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped invalid group %q\n", group))
+			continue
+		}
+
+		key := username + ":" + group
+		if member {
+			if server.findGroup(group) < 0 && !newGroups[group] {
+				newGroups[group] = true
+				script.WriteString(sudoCommand(server.RootPassword, "sh -c "+shellQuote(
+					fmt.Sprintf("getent group %s >/dev/null || groupadd %s", group, group))) + "\n")
+			}
+			script.WriteString(markResult(key, sudoCommand(server.RootPassword, fmt.Sprintf("usermod -aG %s %s", group, username))))
+		} else {
+			script.WriteString(markResult(key, sudoCommand(server.RootPassword, fmt.Sprintf("gpasswd -d %s %s", username, group))))
+		}
+		valid = append(valid, a)
+	}
+
+	if len(valid) == 0 {
+		logBuilder.WriteString("⚠️ No valid group assignments found.\n")
+		return logBuilder.String()
+	}
+
+	output, err := runRemoteUnlocked(ip, server, script.String())
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	}
+	results, rest := parseResults(output)
+	server, ok := ipMap[ip]
+	if !ok {
+		return logBuilder.String() + serverRemovedLog
+	}
+
+	verb := "added to"
+	if !member {
+		verb = "removed from"
+	}
+	for _, a := range valid {
+		username, group := a[0], a[1]
+		if !results[username+":"+group] {
+			logBuilder.WriteString(fmt.Sprintf("❌ %s could not be %s %s\n", username, verb, group))
+			continue
+		}
+		if member {
+			server.registerGroups(group)
+		}
+		if server.setMembership(username, group, member) {
+			logBuilder.WriteString(fmt.Sprintf("✅ %s %s %s\n", username, verb, group))
+		} else {
+			logBuilder.WriteString(fmt.Sprintf("✅ %s %s %s (not a managed account, membership not recorded)\n", username, verb, group))
+		}
+	}
+
+	ipMap[ip] = server
+	saveIPMap()
+
+	if rest != "" {
+		logBuilder.WriteString("\nOutput:\n" + rest)
+	}
+	return logBuilder.String()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Conflict policies for imported usernames that already exist, with the
+// label used in results
+var conflictPolicies = map[string]string{
+	"skip":            "skip",
+	"update_password": "update password",
+	"fail":            "fail",
+}
+
+const defaultConflictPolicy = "skip"
+
+// conflictPolicy reads the conflict policy of an import form
+func conflictPolicy(r *http.Request) (string, error) {
+	policy := strings.TrimSpace(r.FormValue("on_conflict"))
+	if policy == "" {
+		return defaultConflictPolicy, nil
+	}
+	if _, ok := conflictPolicies[policy]; !ok {
+		return "", fmt.Errorf("unknown conflict policy %q", policy)
+	}
+	return policy, nil
+}
+
+// upsertAccount stores an account, replacing a stored account of the same name
+func (server *ServerInfo) upsertAccount(account UserAccount) {
+	if i := accountIndex(*server, account.Username); i >= 0 {
+		server.Accounts[i] = account
+		return
+	}
+	server.Accounts = append(server.Accounts, account)
+}
+
+// dedupeAccounts drops repeated accounts left by earlier imports, keeping
+// the last entry of each username as it holds the newest password
+func (server *ServerInfo) dedupeAccounts() int {
+	last := make(map[string]int)
+	for i, account := range server.Accounts {
+		last[account.Username] = i
+	}
+	if len(last) == len(server.Accounts) {
+		return 0
+	}
+
+	var accounts []UserAccount
+	for i, account := range server.Accounts {
+		if last[account.Username] == i {
+			accounts = append(accounts, account)
+		}
+	}
+	removed := len(server.Accounts) - len(accounts)
+	server.Accounts = accounts
+	return removed
+}
+
+// importAccounts creates imported accounts on a server. Usernames that
+// already exist on the server or in the store are handled by the conflict
+// policy: skipped, given the imported password, or failing the whole import
+// before anything changes. Only accounts that succeeded are stored.
+func importAccounts(ip string, accounts []UserAccount, policy string) string {
+	server := ipMap[ip]
+	label := conflictPolicies[policy]
+
+	var logBuilder strings.Builder
+	if len(accounts) == 0 {
+		logBuilder.WriteString("⚠️ No valid user entries found.\n")
+		return logBuilder.String()
+	}
+
+	var host map[string]HostUser
+	var err error
+	withStoreUnlocked(func() { host, err = readHostUsers(ip, server) })
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Could not read the existing users: %v\n", err))
+		return logBuilder.String()
+	}
+	server, ok := ipMap[ip]
+	if !ok {
+		return logBuilder.String() + serverRemovedLog
+	}
+
+	// Sort out duplicates within the file and conflicts with existing users,
+	// whether on the server or only in the store
+	exists := func(username string) bool {
+		_, onHost := host[username]
+		_, stored := server.findAccount(username)
+		return onHost || stored
+	}
+	var conflicts []string
+	seen := make(map[string]bool)
+	var unique []UserAccount
+	for _, account := range accounts {
+		if seen[account.Username] {
+			logBuilder.WriteString(fmt.Sprintf("⏭️ %s: listed more than once, later row skipped\n", account.Username))
+			continue
+		}
+		seen[account.Username] = true
+		unique = append(unique, account)
+		if exists(account.Username) {
+			conflicts = append(conflicts, account.Username)
+		}
+	}
+
+	if policy == "fail" && len(conflicts) > 0 {
+		logBuilder.WriteString(fmt.Sprintf("❌ Import aborted (policy: %s), nothing was changed. These users already exist on %s:\n", label, ip))
+		for _, username := range conflicts {
+			logBuilder.WriteString("- " + username + "\n")
+		}
+		return logBuilder.String()
+	}
+
+	// Servers that keep no plaintext only get and store the hash; the
+	// passwords are handed out once
+	hashed := server.hashesPasswords(appSettings)
+	plaintext := make(map[string]string)
+
+	var script strings.Builder
+	var planned []UserAccount
+	for _, account := range unique {
+		if hashed && !isCryptHash(account.Password) {
+			plaintext[account.Username] = account.Password
+		}
+		account.setImportedPassword(account.Password, hashed)
+
+		if !exists(account.Username) {
+			script.WriteString(createUserScript(server.RootPassword, account.Username, account))
+			planned = append(planned, account)
+			continue
+		}
+		_, onHost := host[account.Username]
+		switch {
+		case policy == "skip":
+			logBuilder.WriteString(fmt.Sprintf("⏭️ %s: already exists, skipped (policy: %s)\n", account.Username, label))
+		case policy == "update_password" && onHost:
+			script.WriteString(markResult(account.Username, passwordCommand(server.RootPassword, account)))
+			planned = append(planned, account)
+		case policy == "update_password":
+			// Stored but gone from the server: recreate the stored account
+			// with the imported password rather than storing it twice
+			stored, _ := server.findAccount(account.Username)
+			stored.Password, stored.PasswordHash = account.Password, account.PasswordHash
+			script.WriteString(createUserScript(server.RootPassword, stored.Username, stored))
+			planned = append(planned, stored)
+		}
+	}
+
+	if len(planned) == 0 {
+		return logBuilder.String()
+	}
+
+	output, err := runRemoteUnlocked(ip, server, script.String())
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	}
+	results, rest := parseResults(output)
+	if server, ok = ipMap[ip]; !ok {
+		return logBuilder.String() + serverRemovedLog
+	}
+
+	var credentials []Credential
+	for _, account := range planned {
+		_, existed := host[account.Username]
+		if !results[account.Username] {
+			if existed {
+				logBuilder.WriteString(fmt.Sprintf("❌ %s: already exists, password update failed (policy: %s)\n", account.Username, label))
+			} else {
+				logBuilder.WriteString(fmt.Sprintf("❌ %s: creation failed\n", account.Username))
+			}
+			continue
+		}
+
+		passwordSet := true
+		if existed {
+			// Keep what the store knows about the account beyond the password
+			if stored, ok := server.findAccount(account.Username); ok {
+				stored.Password, stored.PasswordHash = account.Password, account.PasswordHash
+				account = stored
+			}
+			logBuilder.WriteString(fmt.Sprintf("🔑 %s: already exists, password updated (policy: %s)\n", account.Username, label))
+		} else {
+			_, failed := createResults(results, account.Username, account)
+			account = account.withoutFailedSteps(failed)
+			passwordSet = account.hasPassword()
+			if _, stored := server.findAccount(account.Username); stored && len(failed) == 0 {
+				logBuilder.WriteString(fmt.Sprintf("🔑 %s: stored but gone from the server, recreated with the imported password (policy: %s)\n", account.Username, label))
+			} else {
+				logBuilder.WriteString(createdLog(account.Username, failed))
+			}
+		}
+		server.upsertAccount(account)
+		server.registerGroups(append(account.Groups, account.PrimaryGroup)...)
+		if password, ok := plaintext[account.Username]; ok && passwordSet {
+			credentials = append(credentials, Credential{Username: account.Username, Password: password})
+		}
+	}
+
+	ipMap[ip] = server
+	saveIPMap()
+	logBuilder.WriteString(newHandout(ip, "Import", credentials))
+
+	if rest != "" {
+		logBuilder.WriteString("\nOutput:\n" + rest)
+	}
+	return logBuilder.String()
+}
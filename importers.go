@@ -0,0 +1,494 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Importer reads one file format into rows of cells, the model every
+// create and delete import works on. Spreadsheets may hold several sheets;
+// record formats such as JSON and LDIF become a header row of field names
+// followed by one row per record.
+type Importer struct {
+	Name       string
+	Extensions []string
+	// Read returns the rows of the named sheet, the first one when empty,
+	// and the sheet names of the file
+	Read func(data []byte, sheet string) ([][]string, []string, error)
+}
+
+// importers are chosen by file extension
+var importers = []Importer{
+	{"CSV", []string{".csv"}, readCSVTable},
+	{"Excel", []string{".xlsx", ".xlsm"}, readExcelTable},
+	{"OpenDocument spreadsheet", []string{".ods"}, readODSTable},
+	{"JSON", []string{".json"}, readJSONTable},
+	{"YAML", []string{".yaml", ".yml"}, readYAMLTable},
+	{"LDIF", []string{".ldif"}, readLDIFTable},
+}
+
+// Cells repeated beyond this are empty padding spreadsheet programs write
+// up to the last column or row of the sheet
+const maxRepeatedCells = 1024
+
+// findImporter returns the importer of a file name
+func findImporter(filename string) (Importer, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, importer := range importers {
+		for _, e := range importer.Extensions {
+			if e == ext {
+				return importer, nil
+			}
+		}
+	}
+	return Importer{}, fmt.Errorf("unsupported file type %q, use %s", ext, strings.Join(importerExtensions(), ", "))
+}
+
+// importerExtensions lists the file extensions of every importer
+func importerExtensions() []string {
+	var extensions []string
+	for _, importer := range importers {
+		extensions = append(extensions, importer.Extensions...)
+	}
+	return extensions
+}
+
+// importAccept is the accept attribute of import file inputs
+func importAccept() string {
+	return strings.Join(importerExtensions(), ",")
+}
+
+// readCSVTable reads a CSV file
+func readCSVTable(data []byte, sheet string) ([][]string, []string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading CSV file: %v", err)
+	}
+	return rows, nil, nil
+}
+
+// readExcelTable reads a sheet of an Excel workbook
+func readExcelTable(data []byte, sheet string) ([][]string, []string, error) {
+	xlsx, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening Excel file: %v", err)
+	}
+	defer xlsx.Close()
+	sheets := xlsx.GetSheetList()
+	if sheet == "" {
+		sheet = xlsx.GetSheetName(0)
+	} else if idx, _ := xlsx.GetSheetIndex(sheet); idx < 0 {
+		return nil, nil, fmt.Errorf("the workbook has no sheet %q", sheet)
+	}
+	rows, err := xlsx.GetRows(sheet)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading Excel rows: %v", err)
+	}
+	return rows, sheets, nil
+}
+
+// readODSTable reads a sheet of an OpenDocument spreadsheet from its
+// content.xml. Numbers, dates and booleans are taken from their value
+// attributes rather than their formatted text.
+func readODSTable(data []byte, sheet string) ([][]string, []string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening OpenDocument file: %v", err)
+	}
+
+	var content io.ReadCloser
+	for _, entry := range archive.File {
+		if entry.Name == "content.xml" {
+			content, err = entry.Open()
+			break
+		}
+	}
+	if content == nil || err != nil {
+		return nil, nil, fmt.Errorf("not an OpenDocument spreadsheet: no content.xml")
+	}
+	defer content.Close()
+
+	var sheets []string
+	var rows [][]string
+	var row []string
+	var cell strings.Builder
+	var inSheet, inCell bool
+	var rowRepeat, cellRepeat, emptyRows int
+	var cellValue string
+	paragraphs := 0
+
+	attr := func(e xml.StartElement, name string) string {
+		for _, a := range e.Attr {
+			if a.Name.Local == name {
+				return a.Value
+			}
+		}
+		return ""
+	}
+	repeat := func(e xml.StartElement, name string) int {
+		n, err := strconv.Atoi(attr(e, name))
+		if err != nil || n < 1 {
+			return 1
+		}
+		return n
+	}
+
+	decoder := xml.NewDecoder(content)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading OpenDocument content: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table":
+				name := attr(t, "name")
+				sheets = append(sheets, name)
+				inSheet = (sheet == "" && len(sheets) == 1) || name == sheet
+			case "table-row":
+				row, rowRepeat = nil, repeat(t, "number-rows-repeated")
+			case "table-cell", "covered-table-cell":
+				inCell, paragraphs = true, 0
+				cell.Reset()
+				cellRepeat = repeat(t, "number-columns-repeated")
+				switch attr(t, "value-type") {
+				case "float", "percentage", "currency":
+					cellValue = attr(t, "value")
+				case "date":
+					cellValue = strings.SplitN(attr(t, "date-value"), "T", 2)[0]
+				case "boolean":
+					cellValue = attr(t, "boolean-value")
+				default:
+					cellValue = ""
+				}
+			case "p":
+				if inCell && paragraphs > 0 {
+					cell.WriteString("\n")
+				}
+				paragraphs++
+			case "s":
+				if inCell {
+					cell.WriteString(strings.Repeat(" ", repeat(t, "c")))
+				}
+			case "tab":
+				if inCell {
+					cell.WriteString("\t")
+				}
+			case "line-break":
+				if inCell {
+					cell.WriteString("\n")
+				}
+			}
+		case xml.CharData:
+			if inCell {
+				cell.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "table":
+				inSheet = false
+			case "table-cell", "covered-table-cell":
+				inCell = false
+				if !inSheet {
+					continue
+				}
+				value := cellValue
+				if value == "" {
+					value = cell.String()
+				}
+				if value == "" && cellRepeat > maxRepeatedCells {
+					cellRepeat = maxRepeatedCells
+				}
+				for i := 0; i < cellRepeat && len(row) < maxRepeatedCells; i++ {
+					row = append(row, value)
+				}
+			case "table-row":
+				if !inSheet {
+					continue
+				}
+				for len(row) > 0 && row[len(row)-1] == "" {
+					row = row[:len(row)-1]
+				}
+				// Empty rows only count when a filled row follows them
+				if len(row) == 0 {
+					emptyRows += min(rowRepeat, maxRepeatedCells)
+					continue
+				}
+				for ; emptyRows > 0; emptyRows-- {
+					rows = append(rows, nil)
+				}
+				for i := 0; i < min(rowRepeat, maxRepeatedCells); i++ {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+
+	if sheet != "" {
+		found := false
+		for _, name := range sheets {
+			found = found || name == sheet
+		}
+		if !found {
+			return nil, nil, fmt.Errorf("the spreadsheet has no sheet %q", sheet)
+		}
+	}
+	return rows, sheets, nil
+}
+
+// readJSONTable reads a JSON list of accounts, or an object holding one
+// under "accounts" or "users" as roster files do
+func readJSONTable(data []byte, sheet string) ([][]string, []string, error) {
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, nil, fmt.Errorf("error reading JSON file: %v", err)
+	}
+	rows, err := recordRows(document)
+	return rows, nil, err
+}
+
+// readYAMLTable reads a YAML list of accounts, or a roster file
+func readYAMLTable(data []byte, sheet string) ([][]string, []string, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, nil, fmt.Errorf("error reading YAML file: %v", err)
+	}
+	rows, err := recordRows(document)
+	return rows, nil, err
+}
+
+// recordRows turns decoded JSON or YAML records into a header row of their
+// keys and one row per record. Lists are joined with ';' as in CSV files.
+func recordRows(document interface{}) ([][]string, error) {
+	if object, ok := document.(map[string]interface{}); ok {
+		document = nil
+		for _, key := range []string{"accounts", "users"} {
+			if list, ok := object[key]; ok {
+				document = list
+				break
+			}
+		}
+	}
+	list, ok := document.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list of accounts, or an object with an \"accounts\" list")
+	}
+
+	var records []map[string]string
+	seen := make(map[string]bool)
+	var keys []string
+	for i, item := range list {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("account %d is not an object", i+1)
+		}
+		record := make(map[string]string)
+		for key, value := range object {
+			record[key] = recordValue(value)
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		records = append(records, record)
+	}
+	return recordTable(records, keys), nil
+}
+
+// recordValue writes a decoded value as a cell
+func recordValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			parts = append(parts, recordValue(item))
+		}
+		return strings.Join(parts, ";")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// recordTable lays records out under a header of their keys, import fields
+// first in their usual order and other keys after them alphabetically
+func recordTable(records []map[string]string, keys []string) [][]string {
+	rank := func(key string) int {
+		for i, field := range importFields {
+			if normalizeHeader(key) == normalizeHeader(field.Name) {
+				return i
+			}
+		}
+		return len(importFields)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		ri, rj := rank(keys[i]), rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+
+	rows := [][]string{keys}
+	for _, record := range records {
+		row := make([]string, len(keys))
+		for i, key := range keys {
+			row[i] = record[key]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// LDAP attributes of posixAccount and inetOrgPerson entries, and the
+// import field each one fills
+var ldifAttributes = map[string]string{
+	"uid":            "username",
+	"userpassword":   "password",
+	"cn":             "name",
+	"displayname":    "full_name",
+	"employeenumber": "rollno",
+	"uidnumber":      "uid",
+	"gidnumber":      "gid",
+	"homedirectory":  "home",
+	"loginshell":     "shell",
+	"sshpublickey":   "ssh_keys",
+	"memberof":       "groups",
+	"shadowexpire":   "expires_on",
+}
+
+// readLDIFTable reads the user entries of an LDIF export, those with a
+// uid. Only {CRYPT} passwords are taken, as crypt hashes; group DNs become
+// their cn, and shadowExpire days become a date.
+func readLDIFTable(data []byte, sheet string) ([][]string, []string, error) {
+	var records []map[string]string
+	entry := make(map[string][]string)
+	flush := func() {
+		if len(entry["username"]) > 0 {
+			record := make(map[string]string)
+			for field, values := range entry {
+				if field == "groups" || field == "ssh_keys" {
+					record[field] = strings.Join(values, ";")
+				} else {
+					record[field] = values[0]
+				}
+			}
+			records = append(records, record)
+		}
+		entry = make(map[string][]string)
+	}
+	add := func(line string) error {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("malformed LDIF line %q", line)
+		}
+		if strings.HasPrefix(value, ":") {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[1:]))
+			if err != nil {
+				return fmt.Errorf("bad base64 value of %s: %v", name, err)
+			}
+			value = string(decoded)
+		} else if strings.HasPrefix(value, "<") {
+			return nil
+		}
+		value = strings.TrimSpace(value)
+
+		// Attribute options such as ";binary" are ignored
+		name, _, _ = strings.Cut(name, ";")
+		field, ok := ldifAttributes[strings.ToLower(name)]
+		if !ok {
+			return nil
+		}
+		switch field {
+		case "password":
+			if !strings.HasPrefix(strings.ToUpper(value), "{CRYPT}") {
+				return nil
+			}
+			value = value[len("{CRYPT}"):]
+		case "groups":
+			rdn, _, _ := strings.Cut(value, ",")
+			if key, cn, ok := strings.Cut(rdn, "="); ok && strings.EqualFold(key, "cn") {
+				value = cn
+			}
+		case "expires_on":
+			days, err := strconv.Atoi(value)
+			if err != nil || days < 0 {
+				return nil
+			}
+			value = time.Unix(0, 0).UTC().AddDate(0, 0, days).Format(dateLayout)
+		}
+		entry[field] = append(entry[field], value)
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var line string
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		// A line starting with a space continues the previous one
+		if strings.HasPrefix(text, " ") && line != "" {
+			line += text[1:]
+			continue
+		}
+		if line != "" && !strings.HasPrefix(line, "#") {
+			if err := add(line); err != nil {
+				return nil, nil, err
+			}
+		}
+		line = text
+		if text == "" {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading LDIF file: %v", err)
+	}
+	if line != "" && !strings.HasPrefix(line, "#") {
+		if err := add(line); err != nil {
+			return nil, nil, err
+		}
+	}
+	flush()
+
+	var keys []string
+	for _, field := range importFields {
+		for _, record := range records {
+			if _, ok := record[field.Name]; ok {
+				keys = append(keys, field.Name)
+				break
+			}
+		}
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("the LDIF file has no entries with a uid")
+	}
+	return recordTable(records, keys), nil, nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Maximum number of servers a job works on at the same time
+const maxParallelServers = 8
+
+// Finished jobs are kept in memory, the newest ones only
+const maxFinishedJobs = 50
+
+// JobTask is one unit of work of a job, e.g. one package on one server
+type JobTask struct {
+	Server string
+	Item   string
+	Status string // pending, running, ok, failed
+	Output string
+	Error  string
+}
+
+// Job tracks a batch of remote tasks run in the background. The run
+// function is called once per server with that server's tasks.
+type Job struct {
+	ID       string
+	Title    string
+	Created  time.Time
+	Finished time.Time
+	Tasks    []*JobTask
+
+	run func(ip string, tasks []*JobTask)
+}
+
+var (
+	jobs   = make(map[string]*Job)
+	jobsMu sync.Mutex
+)
+
+// newID returns a short random identifier
+func newID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startJob registers a job and runs its tasks grouped by server in parallel
+func startJob(title string, tasks []*JobTask, run func(ip string, tasks []*JobTask)) *Job {
+	job := &Job{
+		ID:      newID(),
+		Title:   title,
+		Created: time.Now(),
+		Tasks:   tasks,
+		run:     run,
+	}
+
+	byServer := make(map[string][]*JobTask)
+	var servers []string
+	for _, task := range tasks {
+		task.Status = "pending"
+		if _, ok := byServer[task.Server]; !ok {
+			servers = append(servers, task.Server)
+		}
+		byServer[task.Server] = append(byServer[task.Server], task)
+	}
+
+	jobsMu.Lock()
+	pruneJobs()
+	jobs[job.ID] = job
+	jobsMu.Unlock()
+
+	go func() {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, maxParallelServers)
+		for _, ip := range servers {
+			wg.Add(1)
+			go func(ip string) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				run(ip, byServer[ip])
+			}(ip)
+		}
+		wg.Wait()
+
+		jobsMu.Lock()
+		job.Finished = time.Now()
+		jobsMu.Unlock()
+	}()
+
+	return job
+}
+
+// pruneJobs forgets the oldest finished jobs beyond maxFinishedJobs; running
+// jobs are always kept. jobsMu must be held.
+func pruneJobs() {
+	var finished []*Job
+	for _, job := range jobs {
+		if !job.Finished.IsZero() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].Finished.After(finished[j].Finished)
+	})
+	for _, job := range finished[maxFinishedJobs:] {
+		delete(jobs, job.ID)
+	}
+}
+
+// setTaskStatus updates a task while the job page may be reading it
+func setTaskStatus(task *JobTask, status, output, errMsg string) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	task.Status = status
+	task.Output = output
+	task.Error = errMsg
+}
+
+// failTasks marks every task of a server as failed with the same error
+func failTasks(tasks []*JobTask, errMsg string) {
+	for _, task := range tasks {
+		setTaskStatus(task, "failed", "", errMsg)
+	}
+}
+
+// JobView is a consistent copy of a job for rendering
+type JobView struct {
+	ID       string
+	Title    string
+	Created  time.Time
+	Finished time.Time
+	Running  bool
+	Tasks    []JobTask
+	OK       int
+	Failed   int
+	Pending  int
+}
+
+func (job *Job) view() JobView {
+	v := JobView{
+		ID:       job.ID,
+		Title:    job.Title,
+		Created:  job.Created,
+		Finished: job.Finished,
+		Running:  job.Finished.IsZero(),
+	}
+	for _, task := range job.Tasks {
+		v.Tasks = append(v.Tasks, *task)
+		switch task.Status {
+		case "ok":
+			v.OK++
+		case "failed":
+			v.Failed++
+		default:
+			v.Pending++
+		}
+	}
+	return v
+}
+
+// jobsHandler lists all jobs, newest first
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	jobsMu.Lock()
+	var views []JobView
+	for _, job := range jobs {
+		views = append(views, job.view())
+	}
+	jobsMu.Unlock()
+
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].Created.After(views[j].Created)
+	})
+
+	tmpl := template.Must(template.ParseFiles("templates/jobs.html"))
+	tmpl.Execute(w, views)
+}
+
+// jobHandler shows the per-server, per-item results of a job
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+
+	jobsMu.Lock()
+	job, ok := jobs[id]
+	var v JobView
+	if ok {
+		v = job.view()
+	}
+	jobsMu.Unlock()
+
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/job.html"))
+	tmpl.Execute(w, v)
+}
+
+// retryJobHandler starts a new job re-running only the failed tasks of a job
+func retryJobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimSpace(r.FormValue("id"))
+
+	jobsMu.Lock()
+	job, ok := jobs[id]
+	var failed []*JobTask
+	if ok {
+		if !job.Finished.IsZero() {
+			for _, task := range job.Tasks {
+				if task.Status == "failed" {
+					failed = append(failed, &JobTask{Server: task.Server, Item: task.Item})
+				}
+			}
+		}
+	}
+	jobsMu.Unlock()
+
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if len(failed) == 0 {
+		http.Redirect(w, r, "/jobs/view?id="+id, http.StatusSeeOther)
+		return
+	}
+
+	title := strings.TrimSuffix(job.Title, " (retry)") + " (retry)"
+	retry := startJob(title, failed, job.run)
+	http.Redirect(w, r, "/jobs/view?id="+retry.ID, http.StatusSeeOther)
+}
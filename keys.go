@@ -0,0 +1,388 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Largest username.pub file read from a key archive
+const maxKeyFileSize = 64 << 10
+
+// SSHKeyInfo describes one authorized key of an account for display
+type SSHKeyInfo struct {
+	Type        string
+	Fingerprint string
+	Comment     string
+}
+
+// parseSSHKey validates a public key in authorized_keys format and returns
+// it normalized as "type base64 [comment]". Options are not supported as the
+// whole authorized_keys file is managed here.
+func parseSSHKey(line string) (string, error) {
+	pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return "", fmt.Errorf("invalid SSH public key %q", abbreviateKey(line))
+	}
+	if len(options) > 0 {
+		return "", fmt.Errorf("SSH key options are not supported: %q", abbreviateKey(line))
+	}
+	key := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment = strings.TrimSpace(comment); comment != "" {
+		key += " " + comment
+	}
+	return key, nil
+}
+
+// parseSSHKeys parses keys separated by ';' or line breaks, skipping blank
+// and comment lines
+func parseSSHKeys(s string) ([]string, error) {
+	var keys []string
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ';' || r == '\n' || r == '\r'
+	}) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := parseSSHKey(line)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// abbreviateKey shortens a key for error messages
+func abbreviateKey(line string) string {
+	line = strings.TrimSpace(line)
+	if len(line) > 40 {
+		return line[:40] + "…"
+	}
+	return line
+}
+
+// mergeSSHKeys appends keys that are not there yet, comparing the key
+// material and ignoring comments
+func mergeSSHKeys(keys []string, extra ...string) []string {
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		seen[keyMaterial(key)] = true
+	}
+	for _, key := range extra {
+		if !seen[keyMaterial(key)] {
+			seen[keyMaterial(key)] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// keyMaterial returns the type and base64 part of a normalized key
+func keyMaterial(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return key
+	}
+	return fields[0] + " " + fields[1]
+}
+
+// keyFingerprint returns the SHA256 fingerprint of a normalized key
+func keyFingerprint(key string) string {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(pub)
+}
+
+// KeyInfo lists the authorized keys of an account with their fingerprints
+func (account UserAccount) KeyInfo() []SSHKeyInfo {
+	var infos []SSHKeyInfo
+	for _, key := range account.SSHKeys {
+		pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+		if err != nil {
+			continue
+		}
+		infos = append(infos, SSHKeyInfo{Type: pub.Type(), Fingerprint: ssh.FingerprintSHA256(pub), Comment: comment})
+	}
+	return infos
+}
+
+// readKeyArchive reads an optional zip of username.pub files from a form,
+// or the one an import preview kept under field_upload. It returns nil when
+// the field was left empty.
+func readKeyArchive(r *http.Request, field string) (map[string][]string, error) {
+	var upload *Upload
+	_, _, err := r.FormFile(field)
+	switch {
+	case err == nil:
+		upload, err = receiveUpload(r, field)
+	case r.FormValue(field+"_upload") != "":
+		upload, err = keptUpload(r.FormValue(field+"_upload"), "")
+	case err == http.ErrMissingFile || err == http.ErrNotMultipart:
+		return nil, nil
+	default:
+		upload, err = receiveUpload(r, field)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading key archive: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(upload.Data), int64(len(upload.Data)))
+	if err != nil {
+		return nil, fmt.Errorf("error opening key archive: %v", err)
+	}
+
+	keys := make(map[string][]string)
+	for _, entry := range archive.File {
+		name := path.Base(entry.Name)
+		if entry.FileInfo().IsDir() || !strings.HasSuffix(name, ".pub") || strings.HasPrefix(entry.Name, "__MACOSX/") {
+			continue
+		}
+		username := strings.TrimSuffix(name, ".pub")
+		if !usernamePattern.MatchString(username) {
+			return nil, fmt.Errorf("%s: invalid username %q", entry.Name, username)
+		}
+
+		f, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxKeyFileSize+1))
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		if len(data) > maxKeyFileSize {
+			return nil, fmt.Errorf("%s: file too large", entry.Name)
+		}
+
+		parsed, err := parseSSHKeys(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name, err)
+		}
+		keys[username] = mergeSSHKeys(keys[username], parsed...)
+	}
+	return keys, nil
+}
+
+// addArchiveKeys gives imported accounts the keys of their username.pub file
+// and reports key files that match no imported account
+func addArchiveKeys(accounts []UserAccount, keys map[string][]string) string {
+	var logBuilder strings.Builder
+	used := make(map[string]bool)
+	for i := range accounts {
+		if extra, ok := keys[accounts[i].Username]; ok {
+			accounts[i].SSHKeys = mergeSSHKeys(accounts[i].SSHKeys, extra...)
+			used[accounts[i].Username] = true
+		}
+	}
+	for username := range keys {
+		if !used[username] {
+			logBuilder.WriteString(fmt.Sprintf("⚠️ %s.pub: no such user in the import, ignored\n", username))
+		}
+	}
+	return logBuilder.String()
+}
+
+// authorizedKeysCommand replaces a user's authorized_keys with the given
+// keys, or removes the file when there are none. It runs as the user, not
+// root, so symlinks the user planted in the home directory cannot redirect
+// it; the .ssh directory gets mode 700 and the file mode 600.
+func authorizedKeysCommand(rootPassword, username string, keys []string) string {
+	script := `h=$(getent passwd "$1" | cut -d: -f6) && [ -d "$h" ] && shift && `
+	if len(keys) == 0 {
+		script += `rm -f "$h/.ssh/authorized_keys"`
+	} else {
+		script += `umask 077 && mkdir -p "$h/.ssh" && chmod 700 "$h/.ssh" && ` +
+			`printf '%s\n' "$@" > "$h/.ssh/authorized_keys" && chmod 600 "$h/.ssh/authorized_keys"`
+	}
+	args := []string{shellQuote(username)}
+	for _, key := range keys {
+		args = append(args, shellQuote(key))
+	}
+	return sudoCommand(rootPassword, "-u "+shellQuote(username)+" sh -c "+shellQuote(script)+" sh "+strings.Join(args, " "))
+}
+
+// keysHandler shows the SSH key page of a server
+func keysHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+	data := map[string]interface{}{
+		"Servers": ipMap,
+		"IP":      ip,
+	}
+	if server, ok := ipMap[ip]; ok {
+		data["Server"] = server
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/keys.html"))
+	tmpl.Execute(w, data)
+}
+
+// rotateKeysHandler replaces or extends the keys of one user from pasted
+// keys, or of many users from a zip of username.pub files
+func rotateKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	mode := r.FormValue("mode")
+	if mode != "replace" && mode != "add" {
+		http.Error(w, "Invalid mode", http.StatusBadRequest)
+		return
+	}
+
+	keys, err := readKeyArchive(r, "keyszip")
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if keys == nil {
+		username := strings.TrimSpace(r.FormValue("username"))
+		pasted, err := parseSSHKeys(r.FormValue("keys"))
+		if err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if username == "" || len(pasted) == 0 {
+			http.Error(w, "❌ Choose a user and paste at least one key, or upload a key archive", http.StatusBadRequest)
+			return
+		}
+		keys = map[string][]string{username: pasted}
+	}
+
+	if mode == "add" {
+		for username, extra := range keys {
+			if account, found := server.findAccount(username); found {
+				keys[username] = mergeSSHKeys(append([]string(nil), account.SSHKeys...), extra...)
+			}
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, applySSHKeys(ip, keys))
+}
+
+// removeKeysHandler removes one key of a user, by fingerprint, or all keys
+// of the selected users
+func removeKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	usernames := formUsernames(r)
+	if len(usernames) == 0 {
+		http.Error(w, "❌ No users selected", http.StatusBadRequest)
+		return
+	}
+
+	fingerprint := r.FormValue("fingerprint")
+	keys := make(map[string][]string)
+	for _, username := range usernames {
+		keys[username] = nil
+		account, found := server.findAccount(username)
+		if !found || fingerprint == "" {
+			continue
+		}
+		for _, key := range account.SSHKeys {
+			if keyFingerprint(key) != fingerprint {
+				keys[username] = append(keys[username], key)
+			}
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, applySSHKeys(ip, keys))
+}
+
+// applySSHKeys writes the given key sets to the users' authorized_keys in
+// one session and stores them for the users that succeeded
+func applySSHKeys(ip string, keys map[string][]string) string {
+	server := ipMap[ip]
+
+	var logBuilder strings.Builder
+	var script strings.Builder
+	var valid []string
+	for _, account := range server.Accounts {
+		if _, ok := keys[account.Username]; !ok {
+			continue
+		}
+		script.WriteString(markResult(account.Username, authorizedKeysCommand(server.RootPassword, account.Username, keys[account.Username])))
+		valid = append(valid, account.Username)
+	}
+	for username := range keys {
+		if _, found := server.findAccount(username); !found {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: not a managed account\n", username))
+		}
+	}
+
+	if len(valid) == 0 {
+		logBuilder.WriteString("⚠️ No key changes to apply.\n")
+		return logBuilder.String()
+	}
+
+	logBuilder.WriteString(fmt.Sprintf("🔑 Updating SSH keys of %d accounts on %s\n\n", len(valid), ip))
+
+	output, err := runRemoteUnlocked(ip, server, script.String())
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	}
+	results, rest := parseResults(output)
+	server, ok := ipMap[ip]
+	if !ok {
+		return logBuilder.String() + serverRemovedLog
+	}
+
+	for _, username := range valid {
+		if !results[username] {
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: updating authorized_keys failed\n", username))
+			continue
+		}
+		if i := accountIndex(server, username); i >= 0 {
+			server.Accounts[i].SSHKeys = keys[username]
+		}
+		if len(keys[username]) == 0 {
+			logBuilder.WriteString(fmt.Sprintf("🗑️ %s: all SSH keys removed\n", username))
+		} else {
+			logBuilder.WriteString(fmt.Sprintf("✅ %s: %d SSH keys installed\n", username, len(keys[username])))
+		}
+	}
+
+	ipMap[ip] = server
+	saveIPMap()
+
+	if rest != "" {
+		logBuilder.WriteString("\nOutput:\n" + rest)
+	}
+	return logBuilder.String()
+}
@@ -1,219 +1,546 @@
-// ✅ main.go (UPDATED)
-package main
-
-import (
-	"encoding/csv"
-	"encoding/json"
-	"fmt"
-	"html/template"
-	"io"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
-
-	"golang.org/x/crypto/ssh"
-)
-
-type UserAccount struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-}
-
-type ServerInfo struct {
-	RootUsername string        `json:"root_username"`
-	RootPassword string        `json:"root_password"`
-	Accounts     []UserAccount `json:"accounts"`
-}
-
-var ipMap map[string]ServerInfo
-
-func loadIPMap() error {
-	file, err := os.Open("ipmap.json")
-	if err != nil {
-		ipMap = make(map[string]ServerInfo)
-		return nil
-	}
-	defer file.Close()
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&ipMap)
-	if err != nil {
-		ipMap = make(map[string]ServerInfo)
-	}
-	return err
-}
-
-func saveIPMap() error {
-	file, err := os.Create("ipmap.json")
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	err = json.NewEncoder(file).Encode(ipMap)
-	if err == nil {
-		file.Sync()
-	}
-	return err
-}
-
-func indexHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("templates/index.html"))
-	tmpl.Execute(w, ipMap)
-}
-
-func addIPHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		ip := strings.TrimSpace(r.FormValue("ip"))
-		rootUser := strings.TrimSpace(r.FormValue("root_username"))
-		rootPass := strings.TrimSpace(r.FormValue("root_password"))
-
-		ipMap[ip] = ServerInfo{
-			RootUsername: rootUser,
-			RootPassword: rootPass,
-			Accounts:     []UserAccount{},
-		}
-		saveIPMap()
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-	}
-}
-
-func runRemoteCommand(ip, user, pass, script string) (string, error) {
-	client, err := ssh.Dial("tcp", ip+":22", &ssh.ClientConfig{
-		User:            user,
-		Auth:            []ssh.AuthMethod{ssh.Password(pass)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	})
-	if err != nil {
-		return "", err
-	}
-	defer client.Close()
-
-	session, err := client.NewSession()
-	if err != nil {
-		return "", err
-	}
-	defer session.Close()
-
-	var output strings.Builder
-	session.Stdout = &output
-	session.Stderr = &output
-	session.Stdin = strings.NewReader(script)
-	err = session.Run("sh -s")
-	return output.String(), err
-}
-
-func uploadCSVHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("templates/upload.html"))
-	tmpl.Execute(w, ipMap)
-}
-
-func createUsersHandler(w http.ResponseWriter, r *http.Request) {
-	ip := strings.TrimSpace(r.FormValue("server_ip"))
-	server, ok := ipMap[ip]
-	if !ok {
-		http.Error(w, "❌ IP not found in records", http.StatusBadRequest)
-		fmt.Println("Received IP:", ip)
-		fmt.Println("Available IPs:", ipMap)
-		return
-	}
-
-	file, handler, err := r.FormFile("csvfile")
-	if err != nil {
-		http.Error(w, "Error reading file: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer file.Close()
-
-	path := filepath.Join("uploads", handler.Filename)
-	out, err := os.Create(path)
-	if err != nil {
-		http.Error(w, "Error saving file: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	io.Copy(out, file)
-	out.Close()
-
-	f, err := os.Open(path)
-	if err != nil {
-		http.Error(w, "Failed to open uploaded CSV", http.StatusInternalServerError)
-		return
-	}
-	defer f.Close()
-
-	reader := csv.NewReader(f)
-	_, _ = reader.Read() // skip header
-
-	var script strings.Builder
-	var created []UserAccount
-	var logBuilder strings.Builder
-
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if len(record) < 2 {
-			logBuilder.WriteString(fmt.Sprintf("❌ Skipped invalid row: %v\n", record))
-			continue
-		}
-		username := strings.TrimSpace(record[0])
-		password := strings.TrimSpace(record[1])
-		if username == "" || password == "" {
-			logBuilder.WriteString(fmt.Sprintf("❌ Skipped empty fields: %v\n", record))
-			continue
-		}
-		safePass := strings.ReplaceAll(password, `'`, `'\''`)
-		// Using the working script that solves Ubuntu issues
-		script.WriteString(fmt.Sprintf("echo '%s' | sudo -S useradd -m -s /bin/bash %s && echo '%s:%s' | sudo -S chpasswd\n", server.RootPassword, username, username, safePass))
-		created = append(created, UserAccount{Username: username, Password: password})
-	}
-
-	if len(created) == 0 {
-		logBuilder.WriteString("⚠️ No valid user entries found.\n")
-	}
-
-	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script.String())
-	if err != nil {
-		logBuilder.WriteString("❌ Remote script execution failed:\n")
-	}
-	logBuilder.WriteString(output)
-
-	s := ipMap[ip]
-	s.Accounts = append(s.Accounts, created...)
-	ipMap[ip] = s
-	saveIPMap()
-
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
-}
-
-func main() {
-	os.MkdirAll("uploads", 0755)
-	ipMap = make(map[string]ServerInfo)
-	loadIPMap()
-
-	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/add-ip", addIPHandler)
-	http.HandleFunc("/upload-csv", uploadCSVHandler)
-	http.HandleFunc("/create-users", createUsersHandler)
-	http.HandleFunc("/delete-csv", deleteCSVHandler)
-	http.HandleFunc("/delete-users", deleteUsersHandler)
-	http.HandleFunc("/delete-user", deleteSingleUserHandler)
-	http.HandleFunc("/delete-selected", deleteSelectedUsersHandler)
-	http.HandleFunc("/delete-all", deleteAllUsersHandler)
-
-	// Excel functionality
-	http.HandleFunc("/upload-excel", uploadExcelHandler)
-	http.HandleFunc("/create-users-excel", createUsersFromExcelHandler)
-	http.HandleFunc("/download-users", downloadUsersHandler)
-	http.HandleFunc("/download-all-users", downloadAllUsersHandler)
-	http.HandleFunc("/delete-excel", deleteExcelHandler)
-	http.HandleFunc("/delete-users-excel", deleteUsersFromExcelHandler)
-
-	// Software installation
-	http.HandleFunc("/software", softwareHandler)
-	http.HandleFunc("/install-software", installSoftwareHandler)
-
-	fmt.Println(":8080")
-	http.ListenAndServe(":8080", nil)
-}
+// ✅ main.go (UPDATED)
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type UserAccount struct {
+	Username     string   `json:"username"`
+	Password     string   `json:"password"`
+	PasswordHash string   `json:"password_hash,omitempty"` // SHA-512 crypt, set instead of Password when no plaintext is kept
+	FullName     string   `json:"full_name,omitempty"`
+	OriginalName string   `json:"original_name,omitempty"` // imported name the username was derived from
+	PrimaryGroup string   `json:"primary_group,omitempty"`
+	Groups       []string `json:"groups,omitempty"`
+	Shell        string   `json:"shell,omitempty"`
+	Home         string   `json:"home,omitempty"`
+	UID          int      `json:"uid,omitempty"`
+	GID          int      `json:"gid,omitempty"`
+	RollNo       string   `json:"roll_no,omitempty"`
+	Locked       bool     `json:"locked,omitempty"`
+	ExpiresOn    string   `json:"expires_on,omitempty"` // YYYY-MM-DD
+	// DeleteOnExpiry opts the account into deletion after the grace period
+	DeleteOnExpiry bool     `json:"delete_on_expiry,omitempty"`
+	ImportBatch    string   `json:"import_batch,omitempty"`
+	RemindedOn     string   `json:"reminded_on,omitempty"`
+	SSHKeys        []string `json:"ssh_keys,omitempty"`
+	Quota          *Quota   `json:"quota,omitempty"`
+}
+
+type ServerInfo struct {
+	RootUsername   string        `json:"root_username"`
+	RootPassword   string        `json:"root_password"`
+	Accounts       []UserAccount `json:"accounts"`
+	OSID           string        `json:"os_id,omitempty"`
+	OSVersion      string        `json:"os_version,omitempty"`
+	OSName         string        `json:"os_name,omitempty"`
+	PackageManager string        `json:"package_manager,omitempty"`
+	ServerGroup    string        `json:"server_group,omitempty"`
+	Groups         []GroupInfo   `json:"groups,omitempty"`
+	Archives       []HomeArchive `json:"archives,omitempty"`
+	HashPasswords  bool          `json:"hash_passwords,omitempty"`
+}
+
+var ipMap map[string]ServerInfo
+
+// storeMu guards ipMap and the other stores. It is only held while they are
+// read or updated: request handlers hold it (see lockStore) except while
+// they run remote commands (see withStoreUnlocked), and background jobs
+// take it around their reads and writes, so slow servers never block the
+// web interface.
+var storeMu sync.Mutex
+
+// lockStore serializes request handlers on storeMu
+func lockStore(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storeMu.Lock()
+		defer storeMu.Unlock()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// withStoreUnlocked runs fn with storeMu released, for request handlers
+// that talk to servers. Anything read from the stores before may have
+// changed when it returns, so handlers read them again before updating.
+func withStoreUnlocked(fn func()) {
+	storeMu.Unlock()
+	defer storeMu.Lock()
+	fn()
+}
+
+// Logged when a server is removed while remote commands run on it
+const serverRemovedLog = "❌ The server was removed while the commands ran; their results were not recorded.\n"
+
+// runRemoteUnlocked runs a script on a server from a request handler,
+// releasing storeMu while it runs
+func runRemoteUnlocked(ip string, server ServerInfo, script string) (output string, err error) {
+	withStoreUnlocked(func() {
+		output, err = runRemoteCommand(ip, server.RootUsername, server.RootPassword, script)
+	})
+	return output, err
+}
+
+func loadIPMap() error {
+	file, err := os.Open("ipmap.json")
+	if err != nil {
+		ipMap = make(map[string]ServerInfo)
+		return nil
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	err = decoder.Decode(&ipMap)
+	if err != nil {
+		ipMap = make(map[string]ServerInfo)
+		return err
+	}
+
+	// Repeated uploads used to store the same user more than once
+	for ip, server := range ipMap {
+		if n := server.dedupeAccounts(); n > 0 {
+			fmt.Printf("Removed %d duplicate accounts of %s\n", n, ip)
+			ipMap[ip] = server
+		}
+	}
+	return nil
+}
+
+func saveIPMap() error {
+	file, err := os.Create("ipmap.json")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	err = json.NewEncoder(file).Encode(ipMap)
+	if err == nil {
+		file.Sync()
+	}
+	return err
+}
+
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/index.html"))
+	tmpl.Execute(w, ipMap)
+}
+
+func addIPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		ip := strings.TrimSpace(r.FormValue("ip"))
+		rootUser := strings.TrimSpace(r.FormValue("root_username"))
+		rootPass := strings.TrimSpace(r.FormValue("root_password"))
+		group := strings.TrimSpace(r.FormValue("server_group"))
+
+		ipMap[ip] = ServerInfo{
+			RootUsername: rootUser,
+			RootPassword: rootPass,
+			Accounts:     []UserAccount{},
+			ServerGroup:  group,
+		}
+		saveIPMap()
+
+		// Best effort and in the background: the server may not be
+		// reachable yet
+		go func(server ServerInfo) {
+			info, err := readServerOS(ip, server)
+			if err != nil {
+				fmt.Println("OS detection failed for", ip+":", err)
+				return
+			}
+			storeMu.Lock()
+			defer storeMu.Unlock()
+			if s, ok := ipMap[ip]; ok && s.RootUsername == server.RootUsername {
+				s.applyOS(info)
+				ipMap[ip] = s
+				saveIPMap()
+			}
+		}(ipMap[ip])
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// setServerGroupHandler moves a server into a server group, or out of it when empty
+func setServerGroupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	server.ServerGroup = strings.TrimSpace(r.FormValue("server_group"))
+	ipMap[ip] = server
+	saveIPMap()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// serverGroups returns the sorted names of all server groups
+func serverGroups() []string {
+	seen := make(map[string]bool)
+	var groups []string
+	for _, server := range ipMap {
+		if server.ServerGroup != "" && !seen[server.ServerGroup] {
+			seen[server.ServerGroup] = true
+			groups = append(groups, server.ServerGroup)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// selectedServers collects the servers picked on a form, either directly
+// through "servers" checkboxes or through a "server_group"
+func selectedServers(r *http.Request) []string {
+	seen := make(map[string]bool)
+	var servers []string
+	add := func(ip string) {
+		if _, ok := ipMap[ip]; ok && !seen[ip] {
+			seen[ip] = true
+			servers = append(servers, ip)
+		}
+	}
+
+	for _, ip := range r.Form["servers"] {
+		add(strings.TrimSpace(ip))
+	}
+	if group := strings.TrimSpace(r.FormValue("server_group")); group != "" {
+		for ip, server := range ipMap {
+			if server.ServerGroup == group {
+				add(ip)
+			}
+		}
+	}
+	sort.Strings(servers)
+	return servers
+}
+
+// detectOSHandler re-reads the distribution and package manager of a server
+func detectOSHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	if _, ok := ipMap[ip]; !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	var logBuilder strings.Builder
+	server, err := detectServerOS(ip)
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ OS detection failed: %v\n", err))
+	} else {
+		logBuilder.WriteString(fmt.Sprintf("✅ %s: %s (%s %s), package manager: %s\n",
+			ip, server.OSName, server.OSID, server.OSVersion, server.PackageManager))
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// shellQuote wraps a value in single quotes so the remote shell treats it literally
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, `'`, `'\''`) + "'"
+}
+
+// sudoCommand runs a command through sudo, feeding the root password on stdin
+func sudoCommand(rootPassword, command string) string {
+	return fmt.Sprintf("echo %s | sudo -S %s", shellQuote(rootPassword), command)
+}
+
+// sudoInputCommand runs a command through sudo with input on its stdin. As
+// sudo reads the root password from stdin, the input is written by the
+// printf builtin to a private temporary file, so that neither shows up in
+// the arguments of a process.
+func sudoInputCommand(rootPassword, command, input string) string {
+	return fmt.Sprintf(`{ f=$(mktemp) && printf '%%s\n' %s > "$f" && %s; s=$?; rm -f "$f"; [ $s -eq 0 ]; }`,
+		shellQuote(input), sudoCommand(rootPassword, "sh -c "+shellQuote(command+` < "$1"`)+` sh "$f"`))
+}
+
+// Markers printed by markResult so per-item outcomes can be read back from script output
+const (
+	resultOKMarker   = "@@OK@@"
+	resultFailMarker = "@@FAIL@@"
+)
+
+// markResult wraps a command so it prints whether it succeeded for the given key
+func markResult(key, command string) string {
+	return fmt.Sprintf("if %s; then echo '%s %s'; else echo '%s %s'; fi\n",
+		command, resultOKMarker, key, resultFailMarker, key)
+}
+
+// parseResults reads the markResult lines of a script's output, returning
+// the succeeded keys and the output with marker lines removed
+func parseResults(output string) (map[string]bool, string) {
+	results := make(map[string]bool)
+	var rest strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		if key, ok := strings.CutPrefix(line, resultOKMarker+" "); ok {
+			results[key] = true
+		} else if key, ok := strings.CutPrefix(line, resultFailMarker+" "); ok {
+			results[key] = false
+		} else if line != "" {
+			rest.WriteString(line + "\n")
+		}
+	}
+	return results, rest.String()
+}
+
+// How long connecting to a server may take, and how long a remote script
+// may run before its connection is closed
+const (
+	sshDialTimeout       = 15 * time.Second
+	remoteCommandTimeout = 30 * time.Minute
+)
+
+// dialServer opens an SSH connection to a server with password login. The
+// handshake has the same deadline as connecting, as servers that accept
+// connections but never answer would otherwise hang it.
+func dialServer(ip, user, pass string) (*ssh.Client, error) {
+	addr := net.JoinHostPort(ip, "22")
+	conn, err := net.DialTimeout("tcp", addr, sshDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(sshDialTimeout))
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.Password(pass)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         sshDialTimeout,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+func runRemoteCommand(ip, user, pass, script string) (string, error) {
+	client, err := dialServer(ip, user, pass)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var output strings.Builder
+	session.Stdout = &output
+	session.Stderr = &output
+	session.Stdin = strings.NewReader(script)
+	err = runWithDeadline(client, session, "sh -s")
+	return output.String(), err
+}
+
+// runWithDeadline runs a command in a session, closing the connection when
+// it takes longer than remoteCommandTimeout so hung servers cannot block
+func runWithDeadline(client *ssh.Client, session *ssh.Session, command string) error {
+	var timedOut atomic.Bool
+	deadline := time.AfterFunc(remoteCommandTimeout, func() {
+		timedOut.Store(true)
+		client.Close()
+	})
+	err := session.Run(command)
+	deadline.Stop()
+	if timedOut.Load() {
+		return fmt.Errorf("remote command timed out after %v", remoteCommandTimeout)
+	}
+	return err
+}
+
+func uploadCSVHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/upload.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Servers":  ipMap,
+		"Policies": allPasswordPolicies(),
+		"Presets":  presetNames(),
+		"Accept":   importAccept(),
+		"Settings": appSettings,
+	})
+}
+
+func createUsersHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	_, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "❌ IP not found in records", http.StatusBadRequest)
+		fmt.Println("Received IP:", ip)
+		fmt.Println("Available IPs:", ipMap)
+		return
+	}
+
+	options, err := readImportOptions(r, "file")
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	table, err := readImportTable(r, "csvfile", "csv")
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var logBuilder strings.Builder
+	created, report := table.accounts(options, importBatch(table.Filename))
+	if len(report.Issues) > 0 {
+		report.keep()
+	}
+	logBuilder.WriteString(report.String() + "\n")
+	logBuilder.WriteString(addArchiveKeys(created, options.Keys))
+	logBuilder.WriteString(importAccounts(ip, created, options.Conflict))
+	discardUpload(table.Upload.Name)
+	discardUpload(r.FormValue("keyszip_upload"))
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+func main() {
+	os.MkdirAll(uploadDir, 0700)
+	ipMap = make(map[string]ServerInfo)
+	loadIPMap()
+	if err := loadSoftwareCatalog(); err != nil {
+		fmt.Println("Using built-in software catalog:", err)
+	}
+	if err := loadSoftwareProfiles(); err != nil {
+		fmt.Println("Error loading software profiles:", err)
+	}
+	if err := loadPasswordPolicies(); err != nil {
+		fmt.Println("Error loading password policies:", err)
+	}
+	if err := loadColumnPresets(); err != nil {
+		fmt.Println("Error loading column presets:", err)
+	}
+	if err := loadSettings(); err != nil {
+		fmt.Println("Using default settings:", err)
+	}
+
+	http.HandleFunc("/", indexHandler)
+	http.HandleFunc("/add-ip", addIPHandler)
+	http.HandleFunc("/set-server-group", setServerGroupHandler)
+	http.HandleFunc("/upload-csv", uploadCSVHandler)
+	http.HandleFunc("/create-users", createUsersHandler)
+	http.HandleFunc("/delete-csv", deleteCSVHandler)
+	http.HandleFunc("/delete-users", deleteUsersHandler)
+	http.HandleFunc("/delete-user", deleteSingleUserHandler)
+	http.HandleFunc("/delete-selected", deleteSelectedUsersHandler)
+	http.HandleFunc("/delete-all", deleteAllUsersHandler)
+
+	// Excel functionality
+	http.HandleFunc("/upload-excel", uploadExcelHandler)
+	http.HandleFunc("/create-users-excel", createUsersFromExcelHandler)
+	http.HandleFunc("/imports/preview", importPreviewHandler)
+	http.HandleFunc("/imports/presets", columnPresetsHandler)
+	http.HandleFunc("/imports/presets/delete", deleteColumnPresetHandler)
+	http.HandleFunc("/imports/usernames", usernameRulesHandler)
+	http.HandleFunc("/imports/report", validationReportHandler)
+	http.HandleFunc("/imports/uploads", uploadSettingsHandler)
+	http.HandleFunc("/download-users", downloadUsersHandler)
+	http.HandleFunc("/download-all-users", downloadAllUsersHandler)
+	http.HandleFunc("/export", exportHandler)
+	http.HandleFunc("/delete-excel", deleteExcelHandler)
+	http.HandleFunc("/delete-users-excel", deleteUsersFromExcelHandler)
+
+	// Software installation
+	http.HandleFunc("/software", softwareHandler)
+	http.HandleFunc("/install-software", installSoftwareHandler)
+	http.HandleFunc("/detect-os", detectOSHandler)
+	http.HandleFunc("/software/catalog", catalogHandler)
+	http.HandleFunc("/software/inventory", softwareInventoryHandler)
+	http.HandleFunc("/software/profiles", profilesHandler)
+	http.HandleFunc("/software/profiles/delete", deleteProfileHandler)
+	http.HandleFunc("/software/profiles/apply", applyProfileHandler)
+
+	// Password management
+	http.HandleFunc("/passwords", passwordsHandler)
+	http.HandleFunc("/passwords/reset", resetPasswordsHandler)
+	http.HandleFunc("/passwords/reset-file", resetPasswordsFileHandler)
+	http.HandleFunc("/passwords/policies", passwordPoliciesHandler)
+	http.HandleFunc("/passwords/policies/delete", deletePasswordPolicyHandler)
+	http.HandleFunc("/passwords/storage", passwordStorageHandler)
+	http.HandleFunc("/passwords/verify", verifyPasswordHandler)
+	http.HandleFunc("/handouts", handoutsHandler)
+	http.HandleFunc("/handouts/download", downloadHandoutHandler)
+	http.HandleFunc("/slips", slipsHandler)
+	http.HandleFunc("/slips/print", printSlipsHandler)
+
+	// Account state: lock, unlock and expiry
+	http.HandleFunc("/accounts/state", accountStateHandler)
+	http.HandleFunc("/accounts/lock", lockAccountsHandler)
+	http.HandleFunc("/accounts/expire", expireAccountsHandler)
+	http.HandleFunc("/accounts/state-file", accountStateFileHandler)
+
+	// Scheduled expiry
+	http.HandleFunc("/expirations", expirationsHandler)
+	http.HandleFunc("/expirations/settings", expirySettingsHandler)
+	http.HandleFunc("/expirations/batch", expireBatchHandler)
+	http.HandleFunc("/expirations/run", runExpirySweepHandler)
+
+	// Home directory archives
+	http.HandleFunc("/archives", archivesHandler)
+	http.HandleFunc("/archives/settings", archiveSettingsHandler)
+	http.HandleFunc("/archives/restore", restoreArchiveHandler)
+	http.HandleFunc("/archives/delete", deleteArchiveHandler)
+	http.HandleFunc("/archives/download", downloadArchiveHandler)
+
+	// SSH keys
+	http.HandleFunc("/keys", keysHandler)
+	http.HandleFunc("/keys/rotate", rotateKeysHandler)
+	http.HandleFunc("/keys/remove", removeKeysHandler)
+
+	// Disk quotas
+	http.HandleFunc("/quotas", quotasHandler)
+	http.HandleFunc("/quotas/settings", quotaSettingsHandler)
+	http.HandleFunc("/quotas/set", setQuotasHandler)
+
+	// Reconcile with the servers' user databases
+	http.HandleFunc("/reconcile", reconcileHandler)
+	http.HandleFunc("/reconcile/apply", reconcileApplyHandler)
+
+	// Declarative rosters
+	http.HandleFunc("/roster", rosterHandler)
+	http.HandleFunc("/roster/plan", rosterPlanHandler)
+	http.HandleFunc("/roster/apply", rosterApplyHandler)
+
+	// Group management
+	http.HandleFunc("/groups", groupsHandler)
+	http.HandleFunc("/groups/create", createGroupHandler)
+	http.HandleFunc("/groups/delete", deleteGroupHandler)
+	http.HandleFunc("/groups/members", groupMembersHandler)
+	http.HandleFunc("/groups/bulk", bulkGroupsHandler)
+
+	// Background jobs
+	http.HandleFunc("/jobs", jobsHandler)
+	http.HandleFunc("/jobs/view", jobHandler)
+	http.HandleFunc("/jobs/retry", retryJobHandler)
+
+	startExpiryScheduler()
+	startUploadPurge()
+
+	fmt.Println(":8080")
+	http.ListenAndServe(":8080", limitRequestSize(lockStore(http.DefaultServeMux)))
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const passwordPoliciesFile = "password_policies.json"
+
+// Passwords supplied in import files or resets must be at least this long
+const minPasswordLength = 8
+
+// Pattern placeholders, e.g. {username} or {random:4}
+var patternToken = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+// PasswordPolicy is a named rule generating passwords: "pattern" fills a
+// template with the account's fields, "random" draws characters from the
+// chosen classes and "passphrase" joins random words
+type PasswordPolicy struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Pattern   string `json:"pattern,omitempty"`
+	Length    int    `json:"length,omitempty"`
+	Lower     bool   `json:"lower,omitempty"`
+	Upper     bool   `json:"upper,omitempty"`
+	Digits    bool   `json:"digits,omitempty"`
+	Symbols   bool   `json:"symbols,omitempty"`
+	Words     int    `json:"words,omitempty"`
+	Separator string `json:"separator,omitempty"`
+	BuiltIn   bool   `json:"-"`
+}
+
+// builtInPasswordPolicies are always available and cannot be changed.
+// name@rollno is the old Excel import rule, used only when chosen.
+var builtInPasswordPolicies = map[string]PasswordPolicy{
+	"random":      {Name: "random", Kind: "random", Length: randomPasswordLength, Lower: true, Upper: true, Digits: true, Symbols: true, BuiltIn: true},
+	"passphrase":  {Name: "passphrase", Kind: "passphrase", Words: 5, Separator: "-", BuiltIn: true},
+	"name@rollno": {Name: "name@rollno", Kind: "pattern", Pattern: "{name}@{rollno}", BuiltIn: true},
+}
+
+// Policy used by Excel imports that do not choose one
+const defaultExcelPolicy = "random"
+
+var passwordPolicies map[string]PasswordPolicy
+
+func loadPasswordPolicies() error {
+	passwordPolicies = make(map[string]PasswordPolicy)
+	data, err := os.ReadFile(passwordPoliciesFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &passwordPolicies)
+}
+
+func savePasswordPolicies() error {
+	data, err := json.MarshalIndent(passwordPolicies, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(passwordPoliciesFile, data, 0644)
+}
+
+// findPasswordPolicy looks up a built-in or saved policy by name
+func findPasswordPolicy(name string) (PasswordPolicy, bool) {
+	if policy, ok := builtInPasswordPolicies[name]; ok {
+		return policy, true
+	}
+	policy, ok := passwordPolicies[name]
+	return policy, ok
+}
+
+// allPasswordPolicies lists the built-in policies followed by the saved ones
+func allPasswordPolicies() []PasswordPolicy {
+	var policies []PasswordPolicy
+	for _, name := range []string{"random", "passphrase", "name@rollno"} {
+		policies = append(policies, builtInPasswordPolicies[name])
+	}
+	var names []string
+	for name := range passwordPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		policies = append(policies, passwordPolicies[name])
+	}
+	return policies
+}
+
+// importPasswordPolicy reads the policy chosen on an import form. It returns
+// nil when passwords come from the file; an empty choice uses fallback.
+func importPasswordPolicy(r *http.Request, fallback string) (*PasswordPolicy, error) {
+	name := strings.TrimSpace(r.FormValue("password_policy"))
+	if name == "" {
+		name = fallback
+	}
+	if name == "" || name == "file" {
+		return nil, nil
+	}
+	policy, ok := findPasswordPolicy(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown password policy %q", name)
+	}
+	return &policy, nil
+}
+
+// validate checks a policy before it is saved
+func (policy PasswordPolicy) validate() error {
+	if policy.Name == "" || policy.Name == "file" {
+		return fmt.Errorf("a policy name is required")
+	}
+	switch policy.Kind {
+	case "pattern":
+		if policy.Pattern == "" {
+			return fmt.Errorf("a pattern is required")
+		}
+		for _, match := range patternToken.FindAllStringSubmatch(policy.Pattern, -1) {
+			switch match[1] {
+			case "username", "name", "first", "last", "rollno", "year", "word":
+			case "random", "digits":
+				if n, _ := strconv.Atoi(match[2]); n < 1 || n > 64 {
+					return fmt.Errorf("{%s} needs a length from 1 to 64, e.g. {%s:4}", match[1], match[1])
+				}
+			default:
+				return fmt.Errorf("unknown placeholder {%s}", match[1])
+			}
+		}
+	case "random":
+		if policy.Length < minPasswordLength || policy.Length > 128 {
+			return fmt.Errorf("the length must be from %d to 128", minPasswordLength)
+		}
+		if !policy.Lower && !policy.Upper && !policy.Digits && !policy.Symbols {
+			return fmt.Errorf("choose at least one character class")
+		}
+	case "passphrase":
+		if policy.Words < 3 || policy.Words > 12 {
+			return fmt.Errorf("a passphrase needs 3 to 12 words")
+		}
+		if strings.ContainsAny(policy.Separator, ":\n\r") {
+			return fmt.Errorf("the separator must not contain ':' or line breaks")
+		}
+	default:
+		return fmt.Errorf("unknown policy kind %q", policy.Kind)
+	}
+	return nil
+}
+
+// Description summarizes a policy for the policy lists
+func (policy PasswordPolicy) Description() string {
+	switch policy.Kind {
+	case "pattern":
+		return "pattern " + policy.Pattern
+	case "random":
+		var classes []string
+		for _, class := range []struct {
+			on   bool
+			name string
+		}{{policy.Lower, "lowercase"}, {policy.Upper, "uppercase"}, {policy.Digits, "digits"}, {policy.Symbols, "symbols"}} {
+			if class.on {
+				classes = append(classes, class.name)
+			}
+		}
+		return fmt.Sprintf("%d random characters (%s)", policy.Length, strings.Join(classes, ", "))
+	case "passphrase":
+		return fmt.Sprintf("%d random words separated by %q", policy.Words, policy.Separator)
+	}
+	return policy.Kind
+}
+
+// Example generates a password for a sample account
+func (policy PasswordPolicy) Example() string {
+	password, err := policy.generate(UserAccount{Username: "jdoe", FullName: "Jane Doe", RollNo: "101"})
+	if err != nil {
+		return "❌ " + err.Error()
+	}
+	return password
+}
+
+// generate creates a password for an account following the policy
+func (policy PasswordPolicy) generate(account UserAccount) (string, error) {
+	switch policy.Kind {
+	case "random":
+		var classes []string
+		for _, class := range []struct {
+			on    bool
+			chars string
+		}{{policy.Lower, lowerChars}, {policy.Upper, upperChars}, {policy.Digits, digitChars}, {policy.Symbols, symbolChars}} {
+			if class.on {
+				classes = append(classes, class.chars)
+			}
+		}
+		return randomFromClasses(policy.Length, classes), nil
+	case "passphrase":
+		words := make([]string, policy.Words)
+		for i := range words {
+			words[i] = passphraseWords[randomIndex(len(passphraseWords))]
+		}
+		return strings.Join(words, policy.Separator), nil
+	case "pattern":
+		return expandPattern(policy.Pattern, account)
+	}
+	return "", fmt.Errorf("unknown policy kind %q", policy.Kind)
+}
+
+// expandPattern fills the placeholders of a password pattern:
+// {username}, {name} (full name, or username), {first} and {last} (parts of
+// the full name), {rollno}, {year}, {word}, {random:N} and {digits:N}
+func expandPattern(pattern string, account UserAccount) (string, error) {
+	name := strings.TrimSpace(account.FullName)
+	if name == "" {
+		name = account.Username
+	}
+	parts := strings.Fields(name)
+
+	var err error
+	password := patternToken.ReplaceAllStringFunc(pattern, func(token string) string {
+		match := patternToken.FindStringSubmatch(token)
+		n, _ := strconv.Atoi(match[2])
+		switch match[1] {
+		case "username":
+			return account.Username
+		case "name":
+			return name
+		case "first", "last":
+			if len(parts) == 0 {
+				err = fmt.Errorf("no name recorded")
+				return ""
+			}
+			if match[1] == "first" {
+				return parts[0]
+			}
+			return parts[len(parts)-1]
+		case "rollno":
+			if account.RollNo == "" {
+				err = fmt.Errorf("no roll number recorded")
+			}
+			return account.RollNo
+		case "year":
+			return strconv.Itoa(time.Now().Year())
+		case "word":
+			return passphraseWords[randomIndex(len(passphraseWords))]
+		case "random":
+			return randomFromClasses(n, []string{lowerChars + upperChars + digitChars})
+		case "digits":
+			return randomFromClasses(n, []string{digitChars + "01"})
+		}
+		return token
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(password, "\n\r") {
+		return "", fmt.Errorf("the generated password contains a line break")
+	}
+	return password, nil
+}
+
+// randomIndex returns a uniformly random number in [0, n)
+func randomIndex(n int) int {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(err)
+	}
+	return int(i.Int64())
+}
+
+// randomFromClasses returns a random string of the given length with at
+// least one character of every class
+func randomFromClasses(length int, classes []string) string {
+	alphabet := strings.Join(classes, "")
+	chars := make([]byte, length)
+	for i := range chars {
+		chars[i] = alphabet[randomIndex(len(alphabet))]
+	}
+	// Put one character of each class at distinct random positions
+	if len(classes) <= length {
+		positions := make([]int, length)
+		for i := range positions {
+			positions[i] = i
+		}
+		for i, class := range classes {
+			j := i + randomIndex(length-i)
+			positions[i], positions[j] = positions[j], positions[i]
+			chars[positions[i]] = class[randomIndex(len(class))]
+		}
+	}
+	return string(chars)
+}
+
+// commonPasswords are rejected by the strength check, also with digits or
+// symbols added at the end
+var commonPasswords = map[string]bool{
+	"password": true, "passw0rd": true, "qwerty": true, "qwertyuiop": true, "asdfgh": true,
+	"letmein": true, "welcome": true, "admin": true, "administrator": true, "iloveyou": true,
+	"monkey": true, "dragon": true, "master": true, "sunshine": true, "princess": true,
+	"football": true, "baseball": true, "superman": true, "trustno1": true, "changeme": true,
+	"student": true, "students": true, "college": true, "school": true, "university": true,
+	"default": true, "secret": true, "login": true, "abc": true, "abcdef": true,
+	"": true, // nothing but digits and symbols
+}
+
+// checkPasswordStrength rejects passwords that are short, common, based on
+// the account's own names or roll number, or too simple
+func checkPasswordStrength(password string, account UserAccount) error {
+	if len([]rune(password)) < minPasswordLength {
+		return fmt.Errorf("shorter than %d characters", minPasswordLength)
+	}
+
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] || commonPasswords[strings.TrimRightFunc(lower, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})] {
+		return fmt.Errorf("a commonly used password")
+	}
+
+	personal := append(strings.Fields(account.FullName), account.Username, account.RollNo)
+	for _, part := range personal {
+		if len(part) >= 3 && strings.Contains(lower, strings.ToLower(part)) {
+			return fmt.Errorf("contains the username, name or roll number")
+		}
+	}
+
+	distinct := make(map[rune]bool)
+	var classes [4]bool
+	for _, r := range password {
+		distinct[r] = true
+		switch {
+		case unicode.IsLower(r):
+			classes[0] = true
+		case unicode.IsUpper(r):
+			classes[1] = true
+		case unicode.IsDigit(r):
+			classes[2] = true
+		default:
+			classes[3] = true
+		}
+	}
+	if len(distinct) < 5 {
+		return fmt.Errorf("too repetitive")
+	}
+	kinds := 0
+	for _, used := range classes {
+		if used {
+			kinds++
+		}
+	}
+	if kinds < 3 && len([]rune(password)) < 16 {
+		return fmt.Errorf("use three of lowercase, uppercase, digits and symbols, or at least 16 characters")
+	}
+	return nil
+}
+
+// passwordPoliciesHandler lists the password policies and saves a new one
+func passwordPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	var message string
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		policy := PasswordPolicy{
+			Name:      strings.TrimSpace(r.FormValue("name")),
+			Kind:      r.FormValue("kind"),
+			Pattern:   strings.TrimSpace(r.FormValue("pattern")),
+			Lower:     r.FormValue("lower") == "on",
+			Upper:     r.FormValue("upper") == "on",
+			Digits:    r.FormValue("digits") == "on",
+			Symbols:   r.FormValue("symbols") == "on",
+			Separator: r.FormValue("separator"),
+		}
+		policy.Length, _ = strconv.Atoi(r.FormValue("length"))
+		policy.Words, _ = strconv.Atoi(r.FormValue("words"))
+
+		// Keep only the settings of the chosen kind
+		switch policy.Kind {
+		case "pattern":
+			policy = PasswordPolicy{Name: policy.Name, Kind: policy.Kind, Pattern: policy.Pattern}
+		case "random":
+			policy.Pattern, policy.Words, policy.Separator = "", 0, ""
+		case "passphrase":
+			policy = PasswordPolicy{Name: policy.Name, Kind: policy.Kind, Words: policy.Words, Separator: policy.Separator}
+		}
+
+		if _, builtIn := builtInPasswordPolicies[policy.Name]; builtIn {
+			message = fmt.Sprintf("❌ %q is a built-in policy", policy.Name)
+		} else if err := policy.validate(); err != nil {
+			message = "❌ " + err.Error()
+		} else {
+			passwordPolicies[policy.Name] = policy
+			if err := savePasswordPolicies(); err != nil {
+				message = "❌ Error saving policies: " + err.Error()
+			} else {
+				message = fmt.Sprintf("✅ Policy %q saved", policy.Name)
+			}
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/password_policies.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Policies":  allPasswordPolicies(),
+		"MinLength": minPasswordLength,
+		"Message":   message,
+	})
+}
+
+// deletePasswordPolicyHandler removes a saved password policy
+func deletePasswordPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	delete(passwordPolicies, strings.TrimSpace(r.FormValue("name")))
+	savePasswordPolicies()
+	http.Redirect(w, r, "/passwords/policies", http.StatusSeeOther)
+}
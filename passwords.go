@@ -0,0 +1,303 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// Character classes of random passwords, without look-alikes such as 0/O and 1/l
+const (
+	lowerChars  = "abcdefghijkmnpqrstuvwxyz"
+	upperChars  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	digitChars  = "23456789"
+	symbolChars = "!@#%+=?"
+)
+
+// Characters used for random passwords
+const randomPasswordAlphabet = lowerChars + upperChars + digitChars + symbolChars
+
+const randomPasswordLength = 12
+
+// randomPassword returns a password of the given length from randomPasswordAlphabet
+func randomPassword(length int) string {
+	var b strings.Builder
+	max := big.NewInt(int64(len(randomPasswordAlphabet)))
+	for i := 0; i < length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		b.WriteByte(randomPasswordAlphabet[n.Int64()])
+	}
+	return b.String()
+}
+
+// excelPassword applies the Excel import rule name@rollno to an account
+func excelPassword(account UserAccount) (string, error) {
+	if account.RollNo == "" {
+		return "", fmt.Errorf("no roll number recorded")
+	}
+	name := account.FullName
+	if name == "" {
+		name = account.Username
+	}
+	return fmt.Sprintf("%s@%s", name, account.RollNo), nil
+}
+
+// passwordsHandler shows the password reset page of a server
+func passwordsHandler(w http.ResponseWriter, r *http.Request) {
+	// Also accept the field names of the dashboard selection form
+	query := r.URL.Query()
+	ip := strings.TrimSpace(query.Get("ip"))
+	if ip == "" {
+		ip = strings.TrimSpace(query.Get("server_ip"))
+	}
+	server, ok := ipMap[ip]
+
+	data := map[string]interface{}{
+		"Servers":  ipMap,
+		"IP":       ip,
+		"Policies": allPasswordPolicies(),
+		"Hashed":   appSettings.HashPasswords,
+	}
+	if ok {
+		data["Server"] = server
+		data["Selected"] = append(query["user"], query["selected_users"]...)
+	}
+
+	tmpl := template.Must(template.New("passwords.html").Funcs(template.FuncMap{
+		"contains": func(list []string, s string) bool {
+			for _, item := range list {
+				if item == s {
+					return true
+				}
+			}
+			return false
+		},
+	}).ParseFiles("templates/passwords.html"))
+	tmpl.Execute(w, data)
+}
+
+// resetPasswordsHandler resets the passwords of the selected accounts
+func resetPasswordsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	usernames := r.Form["selected_users"]
+	if r.FormValue("all_users") == "on" {
+		usernames = nil
+		for _, account := range server.Accounts {
+			usernames = append(usernames, account.Username)
+		}
+	}
+	if len(usernames) == 0 {
+		http.Error(w, "❌ No users selected", http.StatusBadRequest)
+		return
+	}
+
+	mode := r.FormValue("mode")
+	explicit := r.FormValue("password")
+	if mode == "explicit" && explicit == "" {
+		http.Error(w, "❌ A password is required", http.StatusBadRequest)
+		return
+	}
+
+	var logBuilder strings.Builder
+	passwords := make(map[string]string)
+	for _, username := range usernames {
+		account, found := server.findAccount(username)
+		if !found {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: not a managed account\n", username))
+			continue
+		}
+
+		switch mode {
+		case "explicit":
+			if err := checkPasswordStrength(explicit, account); err != nil {
+				logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: weak password: %v\n", username, err))
+				continue
+			}
+			passwords[username] = explicit
+		case "policy":
+			policy, ok := findPasswordPolicy(r.FormValue("policy"))
+			if !ok {
+				http.Error(w, "Password policy not found", http.StatusBadRequest)
+				return
+			}
+			password, err := policy.generate(account)
+			if err != nil {
+				logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: %v\n", username, err))
+				continue
+			}
+			passwords[username] = password
+		case "random":
+			passwords[username] = randomPassword(randomPasswordLength)
+		case "excel":
+			password, err := excelPassword(account)
+			if err != nil {
+				logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: %v\n", username, err))
+				continue
+			}
+			passwords[username] = password
+		default:
+			http.Error(w, "Invalid reset mode", http.StatusBadRequest)
+			return
+		}
+	}
+
+	logBuilder.WriteString(applyPasswordResets(ip, passwords, r.FormValue("force_change") == "on"))
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// resetPasswordsFileHandler resets passwords from an uploaded CSV or Excel
+// file with a username column and an optional password column; rows without
+// a password get a random one
+func resetPasswordsFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := readUploadedRows(r, "passwordfile")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var logBuilder strings.Builder
+	passwords := make(map[string]string)
+	for _, row := range rows {
+		if len(row) < 1 || strings.TrimSpace(row[0]) == "" {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped invalid row: %v\n", row))
+			continue
+		}
+		username := strings.TrimSpace(row[0])
+		account, found := server.findAccount(username)
+		if !found {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: not a managed account\n", username))
+			continue
+		}
+
+		password := ""
+		if len(row) > 1 {
+			password = strings.TrimSpace(row[1])
+		}
+		if password == "" {
+			password = randomPassword(randomPasswordLength)
+		} else if err := checkPasswordStrength(password, account); err != nil {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: weak password: %v\n", username, err))
+			continue
+		}
+		passwords[username] = password
+	}
+
+	logBuilder.WriteString(applyPasswordResets(ip, passwords, r.FormValue("force_change") == "on"))
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// applyPasswordResets sets new passwords on a server, optionally forcing a
+// change at next login, and stores a password only once chpasswd succeeded.
+// Servers that keep no plaintext get only the hash, and the new passwords
+// are handed out once.
+func applyPasswordResets(ip string, passwords map[string]string, forceChange bool) string {
+	server := ipMap[ip]
+	hashed := server.hashesPasswords(appSettings)
+	updated := make(map[string]UserAccount)
+
+	var logBuilder strings.Builder
+	if len(passwords) == 0 {
+		logBuilder.WriteString("⚠️ No passwords to reset.\n")
+		return logBuilder.String()
+	}
+
+	var script strings.Builder
+	for _, account := range server.Accounts {
+		password, ok := passwords[account.Username]
+		if !ok {
+			continue
+		}
+		account.setPassword(password, hashed)
+		updated[account.Username] = account
+		script.WriteString(markResult(account.Username, passwordCommand(server.RootPassword, account)))
+		if forceChange {
+			script.WriteString(markResult(account.Username+":chage", sudoCommand(server.RootPassword, "chage -d 0 "+account.Username)))
+		}
+	}
+
+	logBuilder.WriteString(fmt.Sprintf("🔑 Resetting %d passwords on %s\n\n", len(passwords), ip))
+
+	output, err := runRemoteUnlocked(ip, server, script.String())
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	}
+	results, rest := parseResults(output)
+	server, ok := ipMap[ip]
+	if !ok {
+		return logBuilder.String() + serverRemovedLog
+	}
+
+	var credentials []Credential
+	for i, account := range server.Accounts {
+		password := passwords[account.Username]
+		if _, planned := updated[account.Username]; !planned {
+			continue
+		}
+		if !results[account.Username] {
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: password not changed, stored password kept\n", account.Username))
+			continue
+		}
+		server.Accounts[i].Password = updated[account.Username].Password
+		server.Accounts[i].PasswordHash = updated[account.Username].PasswordHash
+		note := ""
+		if forceChange && results[account.Username+":chage"] {
+			note = " (must change at next login)"
+		} else if forceChange {
+			note = " (⚠️ could not force a change at next login)"
+		}
+		if hashed {
+			credentials = append(credentials, Credential{Username: account.Username, Password: password})
+			logBuilder.WriteString(fmt.Sprintf("✅ %s: password changed%s\n", account.Username, note))
+		} else {
+			logBuilder.WriteString(fmt.Sprintf("✅ %s: %s%s\n", account.Username, password, note))
+		}
+	}
+
+	ipMap[ip] = server
+	saveIPMap()
+	logBuilder.WriteString(newHandout(ip, "Password reset", credentials))
+
+	if rest != "" {
+		logBuilder.WriteString("\nOutput:\n" + rest)
+	}
+	return logBuilder.String()
+}
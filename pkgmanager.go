@@ -0,0 +1,512 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PackageManager describes how to drive a distribution's package tool.
+// Package names are appended to the Install, Remove and Upgrade commands.
+// Pin is a format taking a package name and version; empty if pins are
+// not supported. ListInstalled and ListUpgrades are run unprivileged and
+// their output is parsed by parseInstalled and parseUpgrades. Exists is a
+// format taking a quoted package name that succeeds if the repositories
+// know the package. NamePattern and NameRule describe valid package names.
+type PackageManager struct {
+	Name          string
+	Refresh       string
+	Install       string
+	Remove        string
+	Upgrade       string
+	Pin           string
+	ListInstalled string
+	ListUpgrades  string
+	Exists        string
+	NamePattern   *regexp.Regexp
+	NameRule      string
+}
+
+var (
+	lowercaseNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._+-]*$`)
+	lowercaseNameRule    = "must start with a lowercase letter or digit and contain only lowercase letters, digits, '.', '_', '+' and '-'"
+	rpmNamePattern       = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._+-]*$`)
+	rpmNameRule          = "must start with a letter, digit or '_' and contain only letters, digits, '.', '_', '+' and '-'"
+)
+
+// Supported package managers keyed by name
+var packageManagers = map[string]PackageManager{
+	"apk": {
+		Name:          "apk",
+		Refresh:       "apk update",
+		Install:       "apk add",
+		Remove:        "apk del",
+		Upgrade:       "apk add --upgrade",
+		Pin:           "%s=%s",
+		ListInstalled: "apk info -v 2>/dev/null",
+		ListUpgrades:  "apk version -l '<' 2>/dev/null",
+		Exists:        `apk search -e %s 2>/dev/null | grep -q .`,
+		NamePattern:   lowercaseNamePattern,
+		NameRule:      lowercaseNameRule,
+	},
+	"apt": {
+		Name:          "apt",
+		Refresh:       "apt-get update",
+		Install:       "env DEBIAN_FRONTEND=noninteractive apt-get install -y",
+		Remove:        "env DEBIAN_FRONTEND=noninteractive apt-get remove -y",
+		Upgrade:       "env DEBIAN_FRONTEND=noninteractive apt-get install --only-upgrade -y",
+		Pin:           "%s=%s",
+		ListInstalled: `dpkg-query -W -f='${db:Status-Status}\t${Package}\t${Version}\n' | grep '^installed' | cut -f2-`,
+		ListUpgrades:  "apt list --upgradable 2>/dev/null",
+		Exists:        "apt-cache show %s >/dev/null 2>&1",
+		NamePattern:   regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]+$`),
+		NameRule:      "must be at least two characters, start with a lowercase letter or digit and contain only lowercase letters, digits, '.', '+' and '-'",
+	},
+	"dnf": {
+		Name:          "dnf",
+		Refresh:       "dnf makecache -y",
+		Install:       "dnf install -y",
+		Remove:        "dnf remove -y",
+		Upgrade:       "dnf upgrade -y",
+		Pin:           "%s-%s",
+		ListInstalled: `rpm -qa --qf '%{NAME}\t%{VERSION}-%{RELEASE}\n'`,
+		ListUpgrades:  "dnf -q check-update 2>/dev/null",
+		Exists:        "dnf -q info %s >/dev/null 2>&1",
+		NamePattern:   rpmNamePattern,
+		NameRule:      rpmNameRule,
+	},
+	"yum": {
+		Name:          "yum",
+		Refresh:       "yum makecache -y",
+		Install:       "yum install -y",
+		Remove:        "yum remove -y",
+		Upgrade:       "yum update -y",
+		Pin:           "%s-%s",
+		ListInstalled: `rpm -qa --qf '%{NAME}\t%{VERSION}-%{RELEASE}\n'`,
+		ListUpgrades:  "yum -q check-update 2>/dev/null",
+		Exists:        "yum -q info %s >/dev/null 2>&1",
+		NamePattern:   rpmNamePattern,
+		NameRule:      rpmNameRule,
+	},
+	"zypper": {
+		Name:          "zypper",
+		Refresh:       "zypper --non-interactive refresh",
+		Install:       "zypper --non-interactive install",
+		Remove:        "zypper --non-interactive remove",
+		Upgrade:       "zypper --non-interactive update",
+		Pin:           "%s=%s",
+		ListInstalled: `rpm -qa --qf '%{NAME}\t%{VERSION}-%{RELEASE}\n'`,
+		ListUpgrades:  "zypper -q list-updates 2>/dev/null",
+		Exists:        "zypper -q search -x %s >/dev/null 2>&1",
+		NamePattern:   rpmNamePattern,
+		NameRule:      rpmNameRule,
+	},
+	"pacman": {
+		Name:          "pacman",
+		Refresh:       "pacman -Sy --noconfirm",
+		Install:       "pacman -S --noconfirm --needed",
+		Remove:        "pacman -R --noconfirm",
+		Upgrade:       "pacman -S --noconfirm",
+		ListInstalled: "pacman -Q",
+		ListUpgrades:  "pacman -Qu 2>/dev/null",
+		Exists:        "pacman -Si %[1]s >/dev/null 2>&1 || pacman -Qi %[1]s >/dev/null 2>&1",
+		NamePattern:   regexp.MustCompile(`^[a-z0-9@_+][a-z0-9@._+-]*$`),
+		NameRule:      "must contain only lowercase letters, digits, '@', '.', '_', '+' and '-' and not start with '.' or '-'",
+	},
+}
+
+// Distribution IDs from /etc/os-release mapped to their package manager
+var distroPackageManagers = map[string]string{
+	"alpine":              "apk",
+	"debian":              "apt",
+	"ubuntu":              "apt",
+	"linuxmint":           "apt",
+	"pop":                 "apt",
+	"raspbian":            "apt",
+	"kali":                "apt",
+	"fedora":              "dnf",
+	"rhel":                "dnf",
+	"centos":              "dnf",
+	"rocky":               "dnf",
+	"almalinux":           "dnf",
+	"ol":                  "dnf",
+	"amzn":                "dnf",
+	"opensuse":            "zypper",
+	"opensuse-leap":       "zypper",
+	"opensuse-tumbleweed": "zypper",
+	"sles":                "zypper",
+	"suse":                "zypper",
+	"arch":                "pacman",
+	"manjaro":             "pacman",
+	"endeavouros":         "pacman",
+}
+
+// osDetectScript prints /etc/os-release followed by the package tools found on the host
+const osDetectScript = `cat /etc/os-release 2>/dev/null
+for pm in apk apt-get dnf yum zypper pacman; do
+  command -v $pm >/dev/null 2>&1 && echo "PM_FOUND=$pm"
+done
+`
+
+// OSInfo holds the distribution details detected on a remote server
+type OSInfo struct {
+	ID             string
+	IDLike         []string
+	Version        string
+	PrettyName     string
+	PackageManager string
+}
+
+// parseOSRelease extracts distribution details from os-release output
+// and picks a package manager, falling back to the tools found on the host
+func parseOSRelease(output string) OSInfo {
+	var info OSInfo
+	var found []string
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			info.ID = strings.ToLower(value)
+		case "ID_LIKE":
+			info.IDLike = strings.Fields(strings.ToLower(value))
+		case "VERSION_ID":
+			info.Version = value
+		case "PRETTY_NAME":
+			info.PrettyName = value
+		case "PM_FOUND":
+			if value == "apt-get" {
+				value = "apt"
+			}
+			found = append(found, value)
+		}
+	}
+
+	for _, id := range append([]string{info.ID}, info.IDLike...) {
+		if pm, ok := distroPackageManagers[id]; ok {
+			info.PackageManager = pm
+			break
+		}
+	}
+
+	// Older RHEL-family releases only ship yum
+	if info.PackageManager == "dnf" && info.ID != "fedora" && majorVersion(info.Version) > 0 && majorVersion(info.Version) < 8 {
+		info.PackageManager = "yum"
+	}
+
+	if info.PackageManager == "" && len(found) > 0 {
+		info.PackageManager = found[0]
+	}
+
+	return info
+}
+
+// majorVersion returns the leading number of a VERSION_ID value, or 0
+func majorVersion(version string) int {
+	major, _, _ := strings.Cut(version, ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// readServerOS reads /etc/os-release over SSH without touching the store
+func readServerOS(ip string, server ServerInfo) (OSInfo, error) {
+	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, osDetectScript)
+	if err != nil {
+		return OSInfo{}, fmt.Errorf("reading /etc/os-release: %v", err)
+	}
+
+	info := parseOSRelease(output)
+	if info.PackageManager == "" {
+		return info, fmt.Errorf("no supported package manager found on %s", ip)
+	}
+	return info, nil
+}
+
+// applyOS records detected distribution details on a server
+func (server *ServerInfo) applyOS(info OSInfo) {
+	server.OSID = info.ID
+	server.OSVersion = info.Version
+	server.OSName = info.PrettyName
+	server.PackageManager = info.PackageManager
+}
+
+// detectServerOS reads /etc/os-release on the server and records the distribution
+// and package manager on its ServerInfo. It is called by request handlers
+// and releases storeMu while the server is read.
+func detectServerOS(ip string) (ServerInfo, error) {
+	server := ipMap[ip]
+	var info OSInfo
+	var err error
+	withStoreUnlocked(func() { info, err = readServerOS(ip, server) })
+	if err != nil {
+		return server, err
+	}
+
+	server, ok := ipMap[ip]
+	if !ok {
+		return server, fmt.Errorf("server %s was removed meanwhile", ip)
+	}
+	server.applyOS(info)
+	ipMap[ip] = server
+	saveIPMap()
+	return server, nil
+}
+
+// packageManagerFor returns the package manager of a server, detecting it first if unknown
+func packageManagerFor(ip string) (PackageManager, error) {
+	server := ipMap[ip]
+	if server.PackageManager == "" {
+		var err error
+		server, err = detectServerOS(ip)
+		if err != nil {
+			return PackageManager{}, err
+		}
+	}
+	return lookupPackageManager(server.PackageManager)
+}
+
+// lookupPackageManager returns a supported package manager by name
+func lookupPackageManager(name string) (PackageManager, error) {
+	pm, ok := packageManagers[name]
+	if !ok {
+		return PackageManager{}, fmt.Errorf("unsupported package manager %q", name)
+	}
+	return pm, nil
+}
+
+// pinned returns the package name with its version pin applied
+func (pm PackageManager) pinned(pkg, version string) (string, bool) {
+	if version == "" {
+		return pkg, true
+	}
+	if pm.Pin == "" {
+		return pkg, false
+	}
+	return fmt.Sprintf(pm.Pin, pkg, version), true
+}
+
+// installScript builds the refresh and install commands for the given packages
+func (pm PackageManager) installScript(rootPassword string, packages []string) string {
+	var script strings.Builder
+	script.WriteString(sudoCommand(rootPassword, pm.Refresh))
+	script.WriteString(" && ")
+	script.WriteString(sudoCommand(rootPassword, pm.Install+" "+strings.Join(packages, " ")))
+	script.WriteString("\n")
+	return script.String()
+}
+
+// removeScript builds the command removing the given packages
+func (pm PackageManager) removeScript(rootPassword string, packages []string) string {
+	return sudoCommand(rootPassword, pm.Remove+" "+strings.Join(packages, " ")) + "\n"
+}
+
+// upgradeScript builds the refresh and upgrade commands for the given packages
+func (pm PackageManager) upgradeScript(rootPassword string, packages []string) string {
+	var script strings.Builder
+	script.WriteString(sudoCommand(rootPassword, pm.Refresh))
+	script.WriteString(" && ")
+	script.WriteString(sudoCommand(rootPassword, pm.Upgrade+" "+strings.Join(packages, " ")))
+	script.WriteString("\n")
+	return script.String()
+}
+
+// inventoryScript refreshes the package indexes and lists installed and
+// upgradable packages, each list preceded by a marker line
+func (pm PackageManager) inventoryScript(rootPassword string) string {
+	var script strings.Builder
+	script.WriteString(sudoCommand(rootPassword, pm.Refresh) + " >/dev/null 2>&1\n")
+	script.WriteString("echo '" + inventoryInstalledMarker + "'\n")
+	script.WriteString(pm.ListInstalled + "\n")
+	script.WriteString("echo '" + inventoryUpgradesMarker + "'\n")
+	script.WriteString(pm.ListUpgrades + "\n")
+	script.WriteString("true\n")
+	return script.String()
+}
+
+const (
+	inventoryInstalledMarker = "@@INSTALLED@@"
+	inventoryUpgradesMarker  = "@@UPGRADES@@"
+)
+
+// PackageInventory holds the installed versions and available updates of a server
+type PackageInventory struct {
+	Installed map[string]string
+	Upgrades  map[string]string
+}
+
+// parseInventory splits inventory script output into installed packages and updates
+func (pm PackageManager) parseInventory(output string) PackageInventory {
+	inv := PackageInventory{
+		Installed: make(map[string]string),
+		Upgrades:  make(map[string]string),
+	}
+
+	section := ""
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case inventoryInstalledMarker, inventoryUpgradesMarker:
+			section = line
+			continue
+		case "":
+			continue
+		}
+
+		var name, version string
+		if section == inventoryInstalledMarker {
+			name, version = pm.parseInstalledLine(line)
+			if name != "" {
+				inv.Installed[name] = version
+			}
+		} else if section == inventoryUpgradesMarker {
+			name, version = pm.parseUpgradeLine(line)
+			if name != "" {
+				inv.Upgrades[name] = version
+			}
+		}
+	}
+	return inv
+}
+
+// parseInstalledLine extracts a package name and version from one line of ListInstalled output
+func (pm PackageManager) parseInstalledLine(line string) (string, string) {
+	switch pm.Name {
+	case "apk":
+		// name-1.2.3-r0
+		return splitAPKVersion(line)
+	case "pacman":
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			return fields[0], fields[1]
+		}
+	default:
+		name, version, ok := strings.Cut(line, "\t")
+		if ok {
+			return name, version
+		}
+	}
+	return "", ""
+}
+
+// parseUpgradeLine extracts a package name and new version from one line of ListUpgrades output
+func (pm PackageManager) parseUpgradeLine(line string) (string, string) {
+	fields := strings.Fields(line)
+	switch pm.Name {
+	case "apk":
+		// name-1.2.3-r0 < 1.2.4-r0
+		if len(fields) >= 3 && fields[1] == "<" {
+			name, _ := splitAPKVersion(fields[0])
+			return name, fields[2]
+		}
+	case "apt":
+		// name/suite 1.2.4 amd64 [upgradable from: 1.2.3]
+		if len(fields) >= 2 && strings.Contains(fields[0], "/") {
+			name, _, _ := strings.Cut(fields[0], "/")
+			return name, fields[1]
+		}
+	case "dnf", "yum":
+		// name.arch 1.2.4-1.el9 repo
+		if len(fields) == 3 && strings.Contains(fields[0], ".") {
+			name := fields[0][:strings.LastIndex(fields[0], ".")]
+			return name, fields[1]
+		}
+	case "zypper":
+		// v | repo | name | 1.2.3 | 1.2.4 | x86_64
+		cols := strings.Split(line, "|")
+		if len(cols) >= 5 && strings.TrimSpace(cols[0]) == "v" {
+			return strings.TrimSpace(cols[2]), strings.TrimSpace(cols[4])
+		}
+	case "pacman":
+		// name 1.2.3-1 -> 1.2.4-1
+		if len(fields) >= 4 && fields[2] == "->" {
+			return fields[0], fields[3]
+		}
+	}
+	return "", ""
+}
+
+// splitAPKVersion splits an apk "name-version-rN" string
+func splitAPKVersion(s string) (string, string) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 3 {
+		return s, ""
+	}
+	return strings.Join(parts[:len(parts)-2], "-"), strings.Join(parts[len(parts)-2:], "-")
+}
+
+// parsePackageList splits user input on spaces and commas and validates every
+// name against the package manager's naming rules. Nothing is stripped or
+// rewritten: invalid names are rejected with the reason.
+func (pm PackageManager) parsePackageList(input string) ([]string, error) {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no package names given")
+	}
+
+	var packages, problems []string
+	seen := make(map[string]bool)
+	for _, name := range fields {
+		if !pm.NamePattern.MatchString(name) {
+			problems = append(problems, fmt.Sprintf("%q is not a valid %s package name: %s", name, pm.Name, pm.NameRule))
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			packages = append(packages, name)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return packages, nil
+}
+
+// existsScript refreshes the package indexes and reports for every package
+// whether the repositories provide it
+func (pm PackageManager) existsScript(rootPassword string, packages []string) string {
+	var script strings.Builder
+	script.WriteString(sudoCommand(rootPassword, pm.Refresh) + " >/dev/null 2>&1\n")
+	for _, pkg := range packages {
+		check := fmt.Sprintf(pm.Exists, shellQuote(pkg))
+		script.WriteString(fmt.Sprintf("if %s; then echo 'FOUND %s'; else echo 'MISSING %s'; fi\n", check, pkg, pkg))
+	}
+	return script.String()
+}
+
+// missingPackages checks the remote repositories and returns the packages they do not provide
+func (pm PackageManager) missingPackages(ip string, server ServerInfo, packages []string) ([]string, error) {
+	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, pm.existsScript(server.RootPassword, packages))
+	if err != nil {
+		return nil, fmt.Errorf("checking package repositories: %v", err)
+	}
+
+	found := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "FOUND "); ok {
+			found[name] = true
+		}
+	}
+
+	var missing []string
+	for _, pkg := range packages {
+		if !found[pkg] {
+			missing = append(missing, pkg)
+		}
+	}
+	return missing, nil
+}
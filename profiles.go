@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const profilesFile = "software_profiles.json"
+
+// SoftwareProfile is a named set of catalog entries installed together,
+// e.g. a "web-dev lab" with nginx, nodejs, git and postgresql
+type SoftwareProfile struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Software    []string `json:"software"`
+}
+
+var softwareProfiles map[string]SoftwareProfile
+
+func loadSoftwareProfiles() error {
+	softwareProfiles = make(map[string]SoftwareProfile)
+	data, err := os.ReadFile(profilesFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &softwareProfiles)
+}
+
+func saveSoftwareProfiles() error {
+	data, err := json.MarshalIndent(softwareProfiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(profilesFile, data, 0644)
+}
+
+// profilesHandler lists software profiles and creates or updates one
+func profilesHandler(w http.ResponseWriter, r *http.Request) {
+	var message string
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		profile := SoftwareProfile{
+			Name:        strings.TrimSpace(r.FormValue("name")),
+			Description: strings.TrimSpace(r.FormValue("description")),
+		}
+		for _, name := range r.Form["software"] {
+			if _, ok := findSoftware(name); ok {
+				profile.Software = append(profile.Software, name)
+			}
+		}
+
+		if profile.Name == "" {
+			message = "❌ Profile name is required"
+		} else if len(profile.Software) == 0 {
+			message = "❌ Select at least one software package"
+		} else {
+			softwareProfiles[profile.Name] = profile
+			if err := saveSoftwareProfiles(); err != nil {
+				message = "❌ Error saving profiles: " + err.Error()
+			} else {
+				message = fmt.Sprintf("✅ Profile %q saved with %d packages", profile.Name, len(profile.Software))
+			}
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/software_profiles.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Profiles": softwareProfiles,
+		"Software": softwareCatalog,
+		"Servers":  ipMap,
+		"Groups":   serverGroups(),
+		"Message":  message,
+	})
+}
+
+// deleteProfileHandler removes a software profile
+func deleteProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	delete(softwareProfiles, strings.TrimSpace(r.FormValue("name")))
+	saveSoftwareProfiles()
+	http.Redirect(w, r, "/software/profiles", http.StatusSeeOther)
+}
+
+// applyProfileHandler installs a profile on the selected servers through a job
+func applyProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	profile, ok := softwareProfiles[strings.TrimSpace(r.FormValue("profile"))]
+	if !ok {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	servers := selectedServers(r)
+	if len(servers) == 0 {
+		http.Error(w, "Select at least one server or server group", http.StatusBadRequest)
+		return
+	}
+
+	var tasks []*JobTask
+	for _, ip := range servers {
+		for _, name := range profile.Software {
+			tasks = append(tasks, &JobTask{Server: ip, Item: name})
+		}
+	}
+
+	title := fmt.Sprintf("Install profile %q on %d servers", profile.Name, len(servers))
+	job := startJob(title, tasks, runSoftwareTasks)
+	http.Redirect(w, r, "/jobs/view?id="+job.ID, http.StatusSeeOther)
+}
+
+// runSoftwareTasks installs catalog entries on one server, one after another
+func runSoftwareTasks(ip string, tasks []*JobTask) {
+	storeMu.Lock()
+	server, ok := ipMap[ip]
+	storeMu.Unlock()
+	if !ok {
+		failTasks(tasks, "server is no longer managed")
+		return
+	}
+
+	if server.PackageManager == "" {
+		info, err := readServerOS(ip, server)
+		if err != nil {
+			failTasks(tasks, err.Error())
+			return
+		}
+		server.applyOS(info)
+
+		storeMu.Lock()
+		if s, ok := ipMap[ip]; ok {
+			s.applyOS(info)
+			ipMap[ip] = s
+			saveIPMap()
+		}
+		storeMu.Unlock()
+	}
+
+	pm, err := lookupPackageManager(server.PackageManager)
+	if err != nil {
+		failTasks(tasks, err.Error())
+		return
+	}
+
+	for _, task := range tasks {
+		setTaskStatus(task, "running", "", "")
+
+		storeMu.Lock()
+		software, ok := findSoftware(task.Item)
+		storeMu.Unlock()
+		if !ok {
+			setTaskStatus(task, "failed", "", "not in the software catalog")
+			continue
+		}
+
+		script, warnings, err := software.installScript(server, pm)
+		if err != nil {
+			setTaskStatus(task, "failed", "", err.Error())
+			continue
+		}
+
+		output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script)
+		for _, warning := range warnings {
+			output = "⚠️ " + warning + "\n" + output
+		}
+		if err != nil {
+			setTaskStatus(task, "failed", output, err.Error())
+		} else {
+			setTaskStatus(task, "ok", output, "")
+		}
+	}
+}
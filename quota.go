@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Quota is a disk quota of a user. Block limits are in 1 KiB blocks as used
+// by setquota; zero means no limit.
+type Quota struct {
+	BlockSoft int64 `json:"block_soft"`
+	BlockHard int64 `json:"block_hard"`
+	InodeSoft int64 `json:"inode_soft"`
+	InodeHard int64 `json:"inode_hard"`
+}
+
+// QuotaUsage is one line of a repquota report
+type QuotaUsage struct {
+	Device     string
+	Username   string
+	BlocksUsed int64
+	BlockSoft  int64
+	BlockHard  int64
+	FilesUsed  int64
+	InodeSoft  int64
+	InodeHard  int64
+	OverLimit  bool
+	Managed    bool
+	Assigned   *Quota // quota recorded for a managed account
+}
+
+// parseSize parses a block size in KiB, accepting K, M, G and T suffixes
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	if value == "" {
+		return 0, nil
+	}
+	multiplier := int64(1)
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(value, unit) {
+			value = strings.TrimSuffix(value, unit)
+			multiplier = int64(1) << (10 * i)
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// formatSize formats a size in KiB for display
+func formatSize(kb int64) string {
+	switch {
+	case kb == 0:
+		return "0"
+	case kb >= 1<<20 && kb%(1<<20) == 0:
+		return fmt.Sprintf("%dG", kb>>20)
+	case kb >= 1<<20:
+		return fmt.Sprintf("%.1fG", float64(kb)/(1<<20))
+	case kb >= 1<<10:
+		return fmt.Sprintf("%dM", kb>>10)
+	}
+	return fmt.Sprintf("%dK", kb)
+}
+
+// newQuota builds a quota from its four limits, checking soft <= hard. It
+// returns nil when no limit is set.
+func newQuota(blockSoft, blockHard, inodeSoft, inodeHard string) (*Quota, error) {
+	var q Quota
+	var err error
+	if q.BlockSoft, err = parseSize(blockSoft); err != nil {
+		return nil, err
+	}
+	if q.BlockHard, err = parseSize(blockHard); err != nil {
+		return nil, err
+	}
+	for _, field := range []struct {
+		value string
+		limit *int64
+	}{{inodeSoft, &q.InodeSoft}, {inodeHard, &q.InodeHard}} {
+		value := strings.TrimSpace(field.value)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid file limit %q", value)
+		}
+		*field.limit = n
+	}
+
+	if q.BlockHard > 0 && q.BlockSoft > q.BlockHard {
+		return nil, fmt.Errorf("soft block limit %s is above the hard limit %s", formatSize(q.BlockSoft), formatSize(q.BlockHard))
+	}
+	if q.InodeHard > 0 && q.InodeSoft > q.InodeHard {
+		return nil, fmt.Errorf("soft file limit %d is above the hard limit %d", q.InodeSoft, q.InodeHard)
+	}
+	if q == (Quota{}) {
+		return nil, nil
+	}
+	return &q, nil
+}
+
+// parseQuota parses the quota import column, written as
+// block_soft/block_hard[/inode_soft/inode_hard], e.g. 900M/1G/10000/12000
+func parseQuota(s string) (*Quota, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 && len(parts) != 4 {
+		return nil, fmt.Errorf("invalid quota %q, expected block_soft/block_hard[/inode_soft/inode_hard]", s)
+	}
+	parts = append(parts, "", "")
+	return newQuota(parts[0], parts[1], parts[2], parts[3])
+}
+
+// formQuota reads the quota fields of a form
+func formQuota(r *http.Request) (*Quota, error) {
+	return newQuota(r.FormValue("quota_block_soft"), r.FormValue("quota_block_hard"),
+		r.FormValue("quota_inode_soft"), r.FormValue("quota_inode_hard"))
+}
+
+// String formats the quota as shown on the quota page
+func (q Quota) String() string {
+	return fmt.Sprintf("%s/%s, %d/%d files", formatSize(q.BlockSoft), formatSize(q.BlockHard), q.InodeSoft, q.InodeHard)
+}
+
+// quotaTarget returns the setquota and repquota argument selecting the
+// filesystems: the configured one or all with quotas enabled
+func quotaTarget(settings Settings) string {
+	if settings.QuotaFilesystem == "" {
+		return "-a"
+	}
+	return shellQuote(settings.QuotaFilesystem)
+}
+
+// setquotaCommand sets a user's quota; a nil quota removes all limits
+func setquotaCommand(rootPassword, username string, q *Quota, settings Settings) string {
+	if q == nil {
+		q = &Quota{}
+	}
+	return sudoCommand(rootPassword, fmt.Sprintf("setquota -u %s %d %d %d %d %s",
+		username, q.BlockSoft, q.BlockHard, q.InodeSoft, q.InodeHard, quotaTarget(settings)))
+}
+
+// parseRepquota parses the output of repquota -p, which prints grace times
+// as numbers so every line has the same columns
+func parseRepquota(output string) []QuotaUsage {
+	var usage []QuotaUsage
+	device := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "*** Report for user quotas on device ") {
+			device = strings.TrimSpace(strings.TrimPrefix(line, "*** Report for user quotas on device "))
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 10 || len(fields[1]) != 2 || strings.Trim(fields[1], "+-") != "" {
+			continue
+		}
+
+		var numbers [6]int64
+		valid := true
+		for i, j := range []int{2, 3, 4, 6, 7, 8} {
+			n, err := strconv.ParseInt(fields[j], 10, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			numbers[i] = n
+		}
+		if !valid {
+			continue
+		}
+		usage = append(usage, QuotaUsage{
+			Device:     device,
+			Username:   fields[0],
+			BlocksUsed: numbers[0],
+			BlockSoft:  numbers[1],
+			BlockHard:  numbers[2],
+			FilesUsed:  numbers[3],
+			InodeSoft:  numbers[4],
+			InodeHard:  numbers[5],
+			OverLimit:  strings.Contains(fields[1], "+"),
+		})
+	}
+	return usage
+}
+
+// quotasHandler shows the quota report of a server
+func quotasHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+	data := map[string]interface{}{
+		"Servers":  ipMap,
+		"IP":       ip,
+		"Settings": appSettings,
+		"Message":  r.URL.Query().Get("message"),
+	}
+
+	if server, ok := ipMap[ip]; ok {
+		data["Server"] = server
+		output, err := runRemoteUnlocked(ip, server, sudoCommand(server.RootPassword, "repquota -u -p "+quotaTarget(appSettings))+"\n")
+		usage := parseRepquota(output)
+		if err != nil && len(usage) == 0 {
+			data["Error"] = strings.TrimSpace(fmt.Sprintf("%v\n%s", err, output))
+		}
+
+		// Show the managed accounts first, the heaviest users on top
+		for i := range usage {
+			account, managed := server.findAccount(usage[i].Username)
+			usage[i].Managed = managed
+			usage[i].Assigned = account.Quota
+		}
+		sort.SliceStable(usage, func(i, j int) bool {
+			if usage[i].Managed != usage[j].Managed {
+				return usage[i].Managed
+			}
+			return usage[i].BlocksUsed > usage[j].BlocksUsed
+		})
+		data["Usage"] = usage
+	}
+
+	tmpl := template.Must(template.New("quotas.html").Funcs(template.FuncMap{
+		"size": formatSize,
+	}).ParseFiles("templates/quotas.html"))
+	tmpl.Execute(w, data)
+}
+
+// quotaSettingsHandler saves the filesystem quotas are set on
+func quotaSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filesystem := strings.TrimSpace(r.FormValue("quota_filesystem"))
+	if filesystem != "" && (!homePattern.MatchString(filesystem) || path.Clean(filesystem) != filesystem) {
+		http.Error(w, "❌ The filesystem must be a mount point or device path", http.StatusBadRequest)
+		return
+	}
+
+	appSettings.QuotaFilesystem = filesystem
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/quotas?ip="+url.QueryEscape(r.FormValue("server_ip"))+"&message=Settings+saved", http.StatusSeeOther)
+}
+
+// setQuotasHandler sets or removes the quota of the selected users
+func setQuotasHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	if _, ok := ipMap[ip]; !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	var quota *Quota
+	if r.FormValue("action") != "remove" {
+		quota, err = formQuota(r)
+		if err != nil {
+			http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if quota == nil {
+			http.Error(w, "❌ Enter at least one limit, or remove the quotas", http.StatusBadRequest)
+			return
+		}
+	}
+
+	usernames := formUsernames(r)
+	if len(usernames) == 0 {
+		http.Error(w, "❌ No users selected", http.StatusBadRequest)
+		return
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, applyQuotas(ip, usernames, quota))
+}
+
+// applyQuotas sets one quota for several users in one session and records
+// it for the users that succeeded
+func applyQuotas(ip string, usernames []string, quota *Quota) string {
+	server := ipMap[ip]
+
+	var logBuilder strings.Builder
+	var script strings.Builder
+	var valid []string
+	for _, username := range usernames {
+		if _, found := server.findAccount(username); !found {
+			logBuilder.WriteString(fmt.Sprintf("❌ Skipped %s: not a managed account\n", username))
+			continue
+		}
+		script.WriteString(markResult(username, setquotaCommand(server.RootPassword, username, quota, appSettings)))
+		valid = append(valid, username)
+	}
+
+	if len(valid) == 0 {
+		logBuilder.WriteString("⚠️ No quota changes to apply.\n")
+		return logBuilder.String()
+	}
+
+	logBuilder.WriteString(fmt.Sprintf("💾 Updating disk quotas of %d accounts on %s\n\n", len(valid), ip))
+
+	output, err := runRemoteUnlocked(ip, server, script.String())
+	if err != nil {
+		logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+	}
+	results, rest := parseResults(output)
+	server, ok := ipMap[ip]
+	if !ok {
+		return logBuilder.String() + serverRemovedLog
+	}
+
+	for _, username := range valid {
+		if !results[username] {
+			logBuilder.WriteString(fmt.Sprintf("❌ %s: setquota failed\n", username))
+			continue
+		}
+		if i := accountIndex(server, username); i >= 0 {
+			server.Accounts[i].Quota = quota
+		}
+		if quota == nil {
+			logBuilder.WriteString(fmt.Sprintf("✅ %s: quota removed\n", username))
+		} else {
+			logBuilder.WriteString(fmt.Sprintf("✅ %s: quota set to %s\n", username, quota))
+		}
+	}
+
+	ipMap[ip] = server
+	saveIPMap()
+
+	if rest != "" {
+		logBuilder.WriteString("\nOutput:\n" + rest)
+	}
+	return logBuilder.String()
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default UID range of regular users when looking for unmanaged accounts
+const (
+	defaultMinUID = 1000
+	defaultMaxUID = 60000
+)
+
+// Markers separating the sections of hostUsersScript output
+const (
+	passwdMarker = "@@PASSWD@@"
+	groupMarker  = "@@GROUP@@"
+)
+
+// hostUsersScript dumps the user and group databases of a server
+const hostUsersScript = "echo '" + passwdMarker + "'\ngetent passwd\necho '" + groupMarker + "'\ngetent group\n"
+
+// HostUser is a user as it exists in a server's user database
+type HostUser struct {
+	Username     string
+	UID          int
+	GID          int
+	FullName     string
+	Home         string
+	Shell        string
+	PrimaryGroup string
+	Groups       []string
+}
+
+// DriftItem is one difference between the store and a server:
+// "missing" (stored but not on the host), "unmanaged" (on the host but not
+// stored) or "differs" (shell or groups disagree)
+type DriftItem struct {
+	Kind        string
+	Username    string
+	Account     UserAccount
+	Host        HostUser
+	Differences []string
+}
+
+// readHostUsers reads the users and groups of a server through getent
+func readHostUsers(ip string, server ServerInfo) (map[string]HostUser, error) {
+	output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, hostUsersScript)
+	if err != nil {
+		return nil, err
+	}
+	return parseHostUsers(output), nil
+}
+
+// parseHostUsers parses the output of hostUsersScript
+func parseHostUsers(output string) map[string]HostUser {
+	users := make(map[string]HostUser)
+	groupNames := make(map[int]string)
+	members := make(map[string][]string)
+
+	section := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch line {
+		case passwdMarker, groupMarker:
+			section = line
+			continue
+		case "":
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		switch {
+		case section == passwdMarker && len(fields) >= 7:
+			uid, err1 := strconv.Atoi(fields[2])
+			gid, err2 := strconv.Atoi(fields[3])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			fullName, _, _ := strings.Cut(fields[4], ",")
+			users[fields[0]] = HostUser{
+				Username: fields[0],
+				UID:      uid,
+				GID:      gid,
+				FullName: fullName,
+				Home:     fields[5],
+				Shell:    fields[6],
+			}
+		case section == groupMarker && len(fields) >= 4:
+			if gid, err := strconv.Atoi(fields[2]); err == nil {
+				groupNames[gid] = fields[0]
+			}
+			for _, member := range strings.Split(fields[3], ",") {
+				if member != "" {
+					members[member] = append(members[member], fields[0])
+				}
+			}
+		}
+	}
+
+	for name, user := range users {
+		user.PrimaryGroup = groupNames[user.GID]
+		for _, group := range members[name] {
+			if group != user.PrimaryGroup {
+				user.Groups = append(user.Groups, group)
+			}
+		}
+		sort.Strings(user.Groups)
+		users[name] = user
+	}
+	return users
+}
+
+// accountDifferences lists where a host user disagrees with a stored account.
+// The shell of a locked account is nologin by design and not compared.
+func accountDifferences(account UserAccount, host HostUser) []string {
+	var diffs []string
+	if !account.Locked && host.Shell != account.loginShell() {
+		diffs = append(diffs, fmt.Sprintf("shell is %s, expected %s", host.Shell, account.loginShell()))
+	}
+	if account.PrimaryGroup != "" && host.PrimaryGroup != account.PrimaryGroup {
+		diffs = append(diffs, fmt.Sprintf("primary group is %s, expected %s", host.PrimaryGroup, account.PrimaryGroup))
+	}
+	expected := append([]string(nil), account.Groups...)
+	sort.Strings(expected)
+	if strings.Join(expected, ",") != strings.Join(host.Groups, ",") {
+		diffs = append(diffs, fmt.Sprintf("groups are [%s], expected [%s]", strings.Join(host.Groups, " "), strings.Join(expected, " ")))
+	}
+	return diffs
+}
+
+// reconcile compares the stored accounts of a server with its users; host
+// users outside the UID range are not reported as unmanaged
+func reconcile(server ServerInfo, host map[string]HostUser, minUID, maxUID int) []DriftItem {
+	var items []DriftItem
+	stored := make(map[string]bool)
+	for _, account := range server.Accounts {
+		stored[account.Username] = true
+		user, ok := host[account.Username]
+		if !ok {
+			items = append(items, DriftItem{Kind: "missing", Username: account.Username, Account: account})
+			continue
+		}
+		if diffs := accountDifferences(account, user); len(diffs) > 0 {
+			items = append(items, DriftItem{Kind: "differs", Username: account.Username, Account: account, Host: user, Differences: diffs})
+		}
+	}
+	for name, user := range host {
+		if !stored[name] && user.UID >= minUID && user.UID <= maxUID {
+			items = append(items, DriftItem{Kind: "unmanaged", Username: name, Host: user})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].Username < items[j].Username
+	})
+	return items
+}
+
+// adoptHostUser updates a stored account, or creates one, from a host user.
+// A locked account keeps its stored shell, as the host's is nologin only
+// until it is unlocked.
+func adoptHostUser(account UserAccount, user HostUser) UserAccount {
+	account.Username = user.Username
+	if account.FullName == "" {
+		account.FullName = user.FullName
+	}
+	switch {
+	case account.Locked:
+	case user.Shell != defaultShell:
+		account.Shell = user.Shell
+	default:
+		account.Shell = ""
+	}
+	if user.PrimaryGroup != user.Username {
+		account.PrimaryGroup = user.PrimaryGroup
+	} else {
+		account.PrimaryGroup = ""
+	}
+	account.Groups = user.Groups
+	return account
+}
+
+// fixAccountCommand builds the usermod call giving a host user the stored
+// shell and groups
+func fixAccountCommand(rootPassword string, account UserAccount) string {
+	var steps []string
+	if ensure := ensureGroupsCommand(account); ensure != "" {
+		steps = append(steps, sudoCommand(rootPassword, ensure))
+	}
+	args := []string{"usermod"}
+	if !account.Locked {
+		args = append(args, "-s", shellQuote(account.loginShell()))
+	}
+	if account.PrimaryGroup != "" {
+		args = append(args, "-g", account.PrimaryGroup)
+	}
+	args = append(args, "-G", shellQuote(strings.Join(account.Groups, ",")), account.Username)
+	steps = append(steps, sudoCommand(rootPassword, strings.Join(args, " ")))
+	return strings.Join(steps, " && ")
+}
+
+// uidRange reads the UID range of a reconcile request
+func uidRange(r *http.Request) (int, int) {
+	minUID, err := strconv.Atoi(r.FormValue("min_uid"))
+	if err != nil {
+		minUID = defaultMinUID
+	}
+	maxUID, err := strconv.Atoi(r.FormValue("max_uid"))
+	if err != nil {
+		maxUID = defaultMaxUID
+	}
+	return minUID, maxUID
+}
+
+// reconcileHandler reads a server's users and shows the drift from the store
+func reconcileHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+	minUID, maxUID := uidRange(r)
+	data := map[string]interface{}{
+		"Servers": ipMap,
+		"IP":      ip,
+		"MinUID":  minUID,
+		"MaxUID":  maxUID,
+	}
+
+	if server, ok := ipMap[ip]; ok {
+		var host map[string]HostUser
+		var err error
+		withStoreUnlocked(func() { host, err = readHostUsers(ip, server) })
+		server, ok = ipMap[ip]
+		switch {
+		case err != nil:
+			data["Error"] = err.Error()
+		case ok:
+			data["Scanned"] = true
+			data["Items"] = reconcile(server, host, minUID, maxUID)
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/reconcile.html"))
+	tmpl.Execute(w, data)
+}
+
+// reconcileApplyHandler adopts, forgets or fixes the selected drift items.
+// The host is read again so the action works on its current state.
+func reconcileApplyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	action := r.FormValue("action")
+	selected := make(map[string]bool)
+	for _, username := range r.Form["items"] {
+		selected[username] = true
+	}
+	if len(selected) == 0 {
+		http.Error(w, "❌ No items selected", http.StatusBadRequest)
+		return
+	}
+
+	var host map[string]HostUser
+	withStoreUnlocked(func() { host, err = readHostUsers(ip, server) })
+	if err != nil {
+		http.Error(w, "Error reading users: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	if server, ok = ipMap[ip]; !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+	minUID, maxUID := uidRange(r)
+
+	var logBuilder strings.Builder
+	var script strings.Builder
+	var fixes []DriftItem
+	plaintext := make(map[string]string)
+	for _, item := range reconcile(server, host, minUID, maxUID) {
+		if !selected[item.Username] {
+			continue
+		}
+		delete(selected, item.Username)
+
+		switch {
+		case action == "adopt" && (item.Kind == "unmanaged" || item.Kind == "differs"):
+			// Host users are later passed to useradd and usermod, so their
+			// names and attributes must be as safe as imported ones
+			adopted := adoptHostUser(item.Account, item.Host)
+			if err := validateAccount(adopted); err != nil {
+				logBuilder.WriteString(fmt.Sprintf("❌ %s: not adopted: %v\n", item.Username, err))
+				continue
+			}
+			if i := accountIndex(server, item.Username); i >= 0 {
+				server.Accounts[i] = adopted
+			} else {
+				server.Accounts = append(server.Accounts, adopted)
+			}
+			server.registerGroups(append(adopted.Groups, adopted.PrimaryGroup)...)
+			logBuilder.WriteString(fmt.Sprintf("✅ %s: adopted from the server\n", item.Username))
+
+		case action == "forget" && item.Kind == "missing":
+			i := accountIndex(server, item.Username)
+			server.Accounts = append(server.Accounts[:i], server.Accounts[i+1:]...)
+			logBuilder.WriteString(fmt.Sprintf("🗑️ %s: removed from the store\n", item.Username))
+
+		case action == "fix" && item.Kind == "missing":
+			account := item.Account
+			if !account.hasPassword() {
+				password := randomPassword(randomPasswordLength)
+				if server.hashesPasswords(appSettings) {
+					plaintext[item.Username] = password
+				}
+				account.setPassword(password, server.hashesPasswords(appSettings))
+			}
+			script.WriteString(createUserScript(server.RootPassword, item.Username, account))
+			item.Account = account
+			fixes = append(fixes, item)
+
+		case action == "fix" && item.Kind == "differs":
+			script.WriteString(markResult(item.Username, fixAccountCommand(server.RootPassword, item.Account)))
+			fixes = append(fixes, item)
+
+		default:
+			logBuilder.WriteString(fmt.Sprintf("⚠️ %s: cannot %s an account that is %s\n", item.Username, action, item.Kind))
+		}
+	}
+	for username := range selected {
+		logBuilder.WriteString(fmt.Sprintf("⚠️ %s: no longer drifted, skipped\n", username))
+	}
+
+	// Adopted and forgotten accounts are stored before the fixes run
+	ipMap[ip] = server
+	saveIPMap()
+
+	if len(fixes) > 0 {
+		output, err := runRemoteUnlocked(ip, server, script.String())
+		if err != nil {
+			logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+		}
+		results, rest := parseResults(output)
+		if server, ok = ipMap[ip]; !ok {
+			fixes = nil
+			logBuilder.WriteString(serverRemovedLog)
+		}
+		var credentials []Credential
+		for _, item := range fixes {
+			if !results[item.Username] {
+				logBuilder.WriteString(fmt.Sprintf("❌ %s: fix failed\n", item.Username))
+				continue
+			}
+			if item.Kind == "missing" {
+				_, failed := createResults(results, item.Username, item.Account)
+				server.upsertAccount(item.Account.withoutFailedSteps(failed))
+				if len(failed) > 0 {
+					logBuilder.WriteString(fmt.Sprintf("⚠️ %s: recreated, but setting its %s failed\n", item.Username, strings.Join(failed, ", ")))
+				} else if password, ok := plaintext[item.Username]; ok {
+					credentials = append(credentials, Credential{Username: item.Username, Password: password})
+					logBuilder.WriteString(fmt.Sprintf("✅ %s: recreated with a new password\n", item.Username))
+				} else if item.Account.Password != "" {
+					logBuilder.WriteString(fmt.Sprintf("✅ %s: recreated with password %s\n", item.Username, item.Account.Password))
+				} else {
+					logBuilder.WriteString(fmt.Sprintf("✅ %s: recreated with its stored password hash\n", item.Username))
+				}
+			} else {
+				logBuilder.WriteString(fmt.Sprintf("✅ %s: shell and groups set to the stored values\n", item.Username))
+			}
+		}
+		logBuilder.WriteString(newHandout(ip, "Reconcile", credentials))
+		if rest != "" {
+			logBuilder.WriteString("\nOutput:\n" + rest)
+		}
+		if ok {
+			ipMap[ip] = server
+			saveIPMap()
+		}
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// accountIndex returns the position of a stored account, or -1
+func accountIndex(server ServerInfo, username string) int {
+	for i, account := range server.Accounts {
+		if account.Username == username {
+			return i
+		}
+	}
+	return -1
+}
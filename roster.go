@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Roster declares the complete set of accounts a server should have. Only
+// accounts managed by this tool are ever removed, and only with
+// RemoveUnlisted set.
+type Roster struct {
+	Name           string          `yaml:"-"`
+	Servers        []string        `yaml:"servers"`
+	ServerGroup    string          `yaml:"server_group"`
+	RemoveUnlisted bool            `yaml:"remove_unlisted"`
+	Accounts       []RosterAccount `yaml:"accounts"`
+	Uploaded       time.Time       `yaml:"-"`
+}
+
+// RosterAccount is one account of a YAML roster
+type RosterAccount struct {
+	Username     string   `yaml:"username"`
+	Password     string   `yaml:"password"`
+	FullName     string   `yaml:"full_name"`
+	PrimaryGroup string   `yaml:"primary_group"`
+	Groups       []string `yaml:"groups"`
+	Shell        string   `yaml:"shell"`
+	Home         string   `yaml:"home"`
+	UID          int      `yaml:"uid"`
+	GID          int      `yaml:"gid"`
+	ExpiresOn    string   `yaml:"expires_on"`
+}
+
+// PlanStep is one change needed to bring a server to its roster: add,
+// remove, update (shell and groups), password, adopt or forget. Adopt and
+// forget only change the store.
+type PlanStep struct {
+	Action   string
+	Username string
+	Account  UserAccount
+	Details  string
+}
+
+// ServerPlan is the plan of one server, or the error reading it
+type ServerPlan struct {
+	Server string
+	Steps  []PlanStep
+	Error  string
+}
+
+// How long an uploaded roster can be applied after its plan was shown
+const rosterLifetime = 24 * time.Hour
+
+// rosters holds the uploaded rosters by ID until they expire
+var rosters = make(map[string]Roster)
+
+// pruneRosters drops rosters older than rosterLifetime
+func pruneRosters(now time.Time) {
+	for id, roster := range rosters {
+		if now.Sub(roster.Uploaded) > rosterLifetime {
+			delete(rosters, id)
+		}
+	}
+}
+
+// parseRoster reads a YAML roster, or a CSV roster using the columns of the
+// CSV import
+func parseRoster(filename string, data []byte) (Roster, error) {
+	var roster Roster
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &roster); err != nil {
+			return roster, fmt.Errorf("error reading YAML roster: %v", err)
+		}
+	case ".csv":
+		reader := csv.NewReader(strings.NewReader(string(data)))
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			return roster, fmt.Errorf("error reading CSV roster: %v", err)
+		}
+		if len(records) > 0 {
+			records = records[1:]
+		}
+		for _, record := range records {
+			if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+				continue
+			}
+			account := UserAccount{Username: strings.TrimSpace(record[0])}
+			if len(record) > 1 {
+				account.Password = strings.TrimSpace(record[1])
+			}
+			if len(record) > 2 {
+				if err := parseAccountAttributes(&account, record[2:]); err != nil {
+					return roster, fmt.Errorf("%s: %v", account.Username, err)
+				}
+			}
+			roster.Accounts = append(roster.Accounts, RosterAccount{
+				Username:     account.Username,
+				Password:     account.Password,
+				FullName:     account.FullName,
+				PrimaryGroup: account.PrimaryGroup,
+				Groups:       account.Groups,
+				Shell:        account.Shell,
+				Home:         account.Home,
+				UID:          account.UID,
+				GID:          account.GID,
+				ExpiresOn:    account.ExpiresOn,
+			})
+		}
+	default:
+		return roster, fmt.Errorf("unsupported roster format %q, use .yaml or .csv", filepath.Ext(filename))
+	}
+
+	roster.Name = filename
+	seen := make(map[string]bool)
+	for _, entry := range roster.Accounts {
+		if seen[entry.Username] {
+			return roster, fmt.Errorf("%s is listed twice", entry.Username)
+		}
+		seen[entry.Username] = true
+		if err := validateAccount(entry.account()); err != nil {
+			return roster, err
+		}
+		if _, err := parseExpiryDate(entry.ExpiresOn); err != nil {
+			return roster, fmt.Errorf("%s: %v", entry.Username, err)
+		}
+		if entry.Password != "" && !isCryptHash(entry.Password) {
+			if err := checkPasswordStrength(entry.Password, entry.account()); err != nil {
+				return roster, fmt.Errorf("%s: weak password: %v", entry.Username, err)
+			}
+		}
+	}
+	return roster, nil
+}
+
+// account converts a roster entry to a stored account
+func (entry RosterAccount) account() UserAccount {
+	return UserAccount{
+		Username:     entry.Username,
+		Password:     entry.Password,
+		FullName:     entry.FullName,
+		PrimaryGroup: entry.PrimaryGroup,
+		Groups:       entry.Groups,
+		Shell:        entry.Shell,
+		Home:         entry.Home,
+		UID:          entry.UID,
+		GID:          entry.GID,
+		ExpiresOn:    entry.ExpiresOn,
+	}
+}
+
+// planRoster computes the steps bringing a server and its stored accounts to
+// the roster. Applying the plan and planning again gives no steps.
+func planRoster(server ServerInfo, host map[string]HostUser, roster Roster) []PlanStep {
+	var steps []PlanStep
+	listed := make(map[string]bool)
+
+	for _, entry := range roster.Accounts {
+		listed[entry.Username] = true
+		desired := entry.account()
+		stored, managed := server.findAccount(entry.Username)
+		if managed {
+			// Keep what the roster does not declare, such as the lock state
+			desired.OriginalName = stored.OriginalName
+			desired.Locked = stored.Locked
+			desired.RollNo = stored.RollNo
+			desired.ImportBatch = stored.ImportBatch
+			desired.RemindedOn = stored.RemindedOn
+			desired.SSHKeys = stored.SSHKeys
+			desired.Quota = stored.Quota
+			if desired.ExpiresOn == "" || desired.ExpiresOn == stored.ExpiresOn {
+				desired.ExpiresOn = stored.ExpiresOn
+				desired.DeleteOnExpiry = stored.DeleteOnExpiry
+			}
+			// Keep the stored password or hash unless the roster sets another
+			if desired.Password == "" || stored.importedPasswordMatches(desired.Password) {
+				desired.Password, desired.PasswordHash = stored.Password, stored.PasswordHash
+			}
+		}
+		// Only the password step sets a new password, so that no other step
+		// stores it when setting it fails
+		current := desired
+		if managed {
+			current.Password, current.PasswordHash = stored.Password, stored.PasswordHash
+		} else {
+			current.Password, current.PasswordHash = "", ""
+		}
+
+		user, exists := host[entry.Username]
+		if !exists {
+			steps = append(steps, PlanStep{Action: "add", Username: entry.Username, Account: desired, Details: "create on the server"})
+			continue
+		}
+
+		changed := false
+		if diffs := accountDifferences(desired, user); len(diffs) > 0 {
+			steps = append(steps, PlanStep{Action: "update", Username: entry.Username, Account: current, Details: strings.Join(diffs, "; ")})
+			changed = true
+		}
+		if entry.Password != "" && (!managed || !stored.importedPasswordMatches(entry.Password)) {
+			steps = append(steps, PlanStep{Action: "password", Username: entry.Username, Account: desired, Details: "set the roster password"})
+			changed = true
+		}
+		if !changed && !managed {
+			steps = append(steps, PlanStep{Action: "adopt", Username: entry.Username, Account: current, Details: "already on the server, start managing it"})
+		} else if !changed && !sameAccount(stored, current) {
+			steps = append(steps, PlanStep{Action: "adopt", Username: entry.Username, Account: current, Details: "record the roster attributes in the store"})
+		}
+	}
+
+	if roster.RemoveUnlisted {
+		for _, account := range server.Accounts {
+			if listed[account.Username] {
+				continue
+			}
+			if _, exists := host[account.Username]; exists {
+				steps = append(steps, PlanStep{Action: "remove", Username: account.Username, Account: account, Details: "not in the roster"})
+			} else {
+				steps = append(steps, PlanStep{Action: "forget", Username: account.Username, Account: account, Details: "not in the roster and already gone from the server"})
+			}
+		}
+	}
+
+	order := map[string]int{"remove": 0, "forget": 1, "add": 2, "update": 3, "password": 4, "adopt": 5}
+	sort.SliceStable(steps, func(i, j int) bool {
+		if order[steps[i].Action] != order[steps[j].Action] {
+			return order[steps[i].Action] < order[steps[j].Action]
+		}
+		return steps[i].Username < steps[j].Username
+	})
+	return steps
+}
+
+// sameAccount reports whether two stored accounts are identical, treating an
+// empty group list like a missing one
+func sameAccount(a, b UserAccount) bool {
+	if len(a.Groups) == 0 {
+		a.Groups = nil
+	}
+	if len(b.Groups) == 0 {
+		b.Groups = nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// rosterTargets returns the servers a roster applies to: those picked on the
+// form and those named in the roster itself
+func rosterTargets(r *http.Request, roster Roster) []string {
+	servers := selectedServers(r)
+	seen := make(map[string]bool)
+	for _, ip := range servers {
+		seen[ip] = true
+	}
+	for ip, server := range ipMap {
+		named := roster.ServerGroup != "" && server.ServerGroup == roster.ServerGroup
+		for _, s := range roster.Servers {
+			named = named || s == ip
+		}
+		if named && !seen[ip] {
+			seen[ip] = true
+			servers = append(servers, ip)
+		}
+	}
+	sort.Strings(servers)
+	return servers
+}
+
+// rosterHandler shows the roster upload form
+func rosterHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/roster.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Servers": ipMap,
+		"Groups":  serverGroups(),
+	})
+}
+
+// rosterPlanHandler reads an uploaded roster and shows the plan for each
+// target server without changing anything
+func rosterPlanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upload, err := receiveUpload(r, "rosterfile")
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	roster, err := parseRoster(upload.Filename, upload.Data)
+	if err != nil {
+		http.Error(w, "❌ "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.FormValue("remove_unlisted") == "on" {
+		roster.RemoveUnlisted = true
+	}
+
+	targets := rosterTargets(r, roster)
+	if len(targets) == 0 {
+		http.Error(w, "Select at least one server or server group", http.StatusBadRequest)
+		return
+	}
+
+	var plans []ServerPlan
+	for _, ip := range targets {
+		plan := ServerPlan{Server: ip}
+		server := ipMap[ip]
+		var host map[string]HostUser
+		var err error
+		withStoreUnlocked(func() { host, err = readHostUsers(ip, server) })
+		server, ok := ipMap[ip]
+		switch {
+		case err != nil:
+			plan.Error = err.Error()
+		case !ok:
+			plan.Error = "server is no longer managed"
+		default:
+			plan.Steps = planRoster(server, host, roster)
+		}
+		plans = append(plans, plan)
+	}
+
+	id := newID()
+	roster.Servers = targets
+	roster.ServerGroup = ""
+	roster.Uploaded = time.Now()
+	pruneRosters(roster.Uploaded)
+	rosters[id] = roster
+
+	tmpl := template.Must(template.ParseFiles("templates/roster_plan.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"ID":     id,
+		"Roster": roster,
+		"Plans":  plans,
+	})
+}
+
+// rosterApplyHandler applies an uploaded roster to its servers through a job.
+// Each server is planned again right before applying, so re-running a roster
+// or retrying a failed server is always safe.
+func rosterApplyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pruneRosters(time.Now())
+	roster, ok := rosters[r.FormValue("id")]
+	if !ok {
+		http.Error(w, "Roster not found or expired, upload it again", http.StatusNotFound)
+		return
+	}
+
+	var tasks []*JobTask
+	for _, ip := range roster.Servers {
+		tasks = append(tasks, &JobTask{Server: ip, Item: "roster " + roster.Name})
+	}
+
+	title := fmt.Sprintf("Apply roster %s to %d servers", roster.Name, len(roster.Servers))
+	job := startJob(title, tasks, func(ip string, tasks []*JobTask) {
+		for _, task := range tasks {
+			setTaskStatus(task, "running", "", "")
+			output, err := applyRoster(ip, roster)
+			if err != nil {
+				setTaskStatus(task, "failed", output, err.Error())
+			} else {
+				setTaskStatus(task, "ok", output, "")
+			}
+		}
+	})
+	http.Redirect(w, r, "/jobs/view?id="+job.ID, http.StatusSeeOther)
+}
+
+// applyRoster plans and applies a roster on one server. The store is only
+// locked while reading and updating it.
+func applyRoster(ip string, roster Roster) (string, error) {
+	storeMu.Lock()
+	server, ok := ipMap[ip]
+	server.Accounts = slices.Clone(server.Accounts)
+	settings := appSettings
+	storeMu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("server is no longer managed")
+	}
+
+	host, err := readHostUsers(ip, server)
+	if err != nil {
+		return "", err
+	}
+	steps := planRoster(server, host, roster)
+
+	var logBuilder strings.Builder
+	if len(steps) == 0 {
+		logBuilder.WriteString("✅ Already matches the roster, nothing to do.\n")
+		return logBuilder.String(), nil
+	}
+
+	// New passwords are hashed before they leave for servers that keep no
+	// plaintext, and handed out once
+	hashed := server.hashesPasswords(settings)
+	plaintext := make(map[string]string)
+	protect := func(i int) {
+		account := &steps[i].Account
+		if account.Password == "" {
+			return
+		}
+		if hashed && !isCryptHash(account.Password) {
+			plaintext[account.Username] = account.Password
+		}
+		account.setImportedPassword(account.Password, hashed)
+	}
+
+	var script strings.Builder
+	for i, step := range steps {
+		key := fmt.Sprintf("%d:%s", i, step.Username)
+		switch step.Action {
+		case "add":
+			if !step.Account.hasPassword() {
+				steps[i].Account.Password = randomPassword(randomPasswordLength)
+			}
+			protect(i)
+			script.WriteString(createUserScript(server.RootPassword, key, steps[i].Account))
+		case "update":
+			script.WriteString(markResult(key, fixAccountCommand(server.RootPassword, step.Account)))
+		case "password":
+			protect(i)
+			script.WriteString(markResult(key, passwordCommand(server.RootPassword, steps[i].Account)))
+		case "remove":
+			script.WriteString(deleteUserScript(server.RootPassword, step.Username, archivePath(settings, step.Username)))
+		}
+	}
+
+	results := make(map[string]bool)
+	var rest string
+	if script.Len() > 0 {
+		output, err := runRemoteCommand(ip, server.RootUsername, server.RootPassword, script.String())
+		if err != nil {
+			logBuilder.WriteString(fmt.Sprintf("❌ Remote script execution failed: %v\n", err))
+		}
+		results, rest = parseResults(output)
+	}
+
+	// Removed users are deleted like on the delete pages: archived first
+	// when archiving is on, and only recorded as gone once userdel worked
+	server.Archives = nil
+	logBuilder.WriteString(catalogArchives(ip, &server, results, settings))
+	homeArchives := server.Archives
+	deleted := deletedUsers(results)
+	for i, step := range steps {
+		if step.Action == "remove" {
+			results[fmt.Sprintf("%d:%s", i, step.Username)] = deleted[step.Username]
+		}
+	}
+
+	failed := 0
+	var credentials []Credential
+	storeMu.Lock()
+	s := ipMap[ip]
+	for i, step := range steps {
+		remote := step.Action != "adopt" && step.Action != "forget"
+		if remote && !results[fmt.Sprintf("%d:%s", i, step.Username)] {
+			failed++
+			logBuilder.WriteString(fmt.Sprintf("❌ %s %s failed\n", step.Action, step.Username))
+			continue
+		}
+
+		// Accounts exist once useradd succeeded, without what later steps
+		// failed to set
+		var incomplete []string
+		if step.Action == "add" {
+			_, incomplete = createResults(results, fmt.Sprintf("%d:%s", i, step.Username), step.Account)
+			step.Account = step.Account.withoutFailedSteps(incomplete)
+		}
+
+		idx := accountIndex(s, step.Username)
+		switch {
+		case step.Action == "remove" || step.Action == "forget":
+			if idx >= 0 {
+				s.Accounts = append(s.Accounts[:idx], s.Accounts[idx+1:]...)
+			}
+		case step.Action == "password" && idx >= 0:
+			// Only the password changed; an update of the same account
+			// is recorded by its own step
+			s.Accounts[idx].Password = step.Account.Password
+			s.Accounts[idx].PasswordHash = step.Account.PasswordHash
+		default:
+			if idx >= 0 {
+				s.Accounts[idx] = step.Account
+			} else {
+				s.Accounts = append(s.Accounts, step.Account)
+			}
+			s.registerGroups(append(step.Account.Groups, step.Account.PrimaryGroup)...)
+		}
+
+		if len(incomplete) > 0 {
+			failed++
+			logBuilder.WriteString(fmt.Sprintf("⚠️ add %s, but setting its %s failed\n", step.Username, strings.Join(incomplete, ", ")))
+		} else if password, ok := plaintext[step.Username]; ok && (step.Action == "add" || step.Action == "password") {
+			credentials = append(credentials, Credential{Username: step.Username, Password: password})
+			logBuilder.WriteString(fmt.Sprintf("✅ %s %s\n", step.Action, step.Username))
+		} else if step.Action == "add" && step.Account.Password != "" {
+			logBuilder.WriteString(fmt.Sprintf("✅ add %s (password %s)\n", step.Username, step.Account.Password))
+		} else {
+			logBuilder.WriteString(fmt.Sprintf("✅ %s %s\n", step.Action, step.Username))
+		}
+	}
+	s.Archives = append(s.Archives, homeArchives...)
+	ipMap[ip] = s
+	saveIPMap()
+	logBuilder.WriteString(newHandout(ip, "Roster "+roster.Name, credentials))
+	storeMu.Unlock()
+
+	if rest != "" {
+		logBuilder.WriteString("\nOutput:\n" + rest)
+	}
+	if failed > 0 {
+		return logBuilder.String(), fmt.Errorf("%d of %d steps failed", failed, len(steps))
+	}
+	return logBuilder.String(), nil
+}
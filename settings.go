@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+const settingsFile = "settings.json"
+
+// Settings holds the server-wide options of the account manager
+type Settings struct {
+	// Days between an account's expiry date, when it is locked, and its deletion
+	ExpiryGraceDays int `json:"expiry_grace_days"`
+	// Days before the expiry date a reminder notice is left in the home directory
+	ExpiryReminderDays int `json:"expiry_reminder_days"`
+	// Whether the scheduler deletes accounts once the grace period is over;
+	// only accounts whose expiry opted into deletion are deleted
+	ExpiryAutoDelete bool `json:"expiry_auto_delete"`
+	// Whether the scheduler may delete accounts while home directories are
+	// not archived; without it their deletion waits for archiving
+	ExpiryDeleteWithoutArchive bool `json:"expiry_delete_without_archive"`
+
+	// Whether home directories are archived before users are deleted
+	ArchiveBeforeDelete bool `json:"archive_before_delete"`
+	// Directory on the server the home directory archives are written to
+	ArchiveDir string `json:"archive_dir"`
+	// Whether archives are copied back to this machine and removed from the server
+	ArchivePull bool `json:"archive_pull"`
+
+	// Mount point or device disk quotas are set on; empty means every
+	// filesystem with quotas enabled
+	QuotaFilesystem string `json:"quota_filesystem"`
+
+	// Whether user passwords are stored only as hashes on every server and
+	// shown once through a credential handout
+	HashPasswords bool `json:"hash_passwords"`
+
+	// How imports without a username column make usernames from names
+	UsernameRule UsernameRule `json:"username_rule"`
+
+	// Largest request body accepted, in megabytes
+	MaxUploadMB int `json:"max_upload_mb"`
+	// Whether uploads kept between requests stay in memory instead of uploads/
+	UploadsInMemory bool `json:"uploads_in_memory"`
+	// Hours an upload kept for a later request is kept before it is purged
+	UploadRetentionHours int `json:"upload_retention_hours"`
+}
+
+var defaultSettings = Settings{
+	ExpiryGraceDays:      14,
+	ExpiryReminderDays:   7,
+	ArchiveDir:           "/var/backups/accountmanager",
+	UsernameRule:         UsernameRule{Style: "full", Separator: "_", Lowercase: true, MaxLength: maxUsernameLength},
+	MaxUploadMB:          20,
+	UploadRetentionHours: 24,
+}
+
+var appSettings = defaultSettings
+
+func loadSettings() error {
+	appSettings = defaultSettings
+	data, err := os.ReadFile(settingsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &appSettings)
+}
+
+func saveSettings() error {
+	data, err := json.MarshalIndent(appSettings, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(settingsFile, data, 0644)
+}
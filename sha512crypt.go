@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Alphabet of crypt(3) salts and hashes
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Rounds of SHA-512 crypt when a hash does not name them, and the bounds
+// glibc clamps named rounds to
+const (
+	sha512CryptRounds    = 5000
+	sha512CryptMinRounds = 1000
+	sha512CryptMaxRounds = 999999999
+)
+
+// sha512Crypt hashes a password with SHA-512 crypt ($6$), the format
+// chpasswd -e and /etc/shadow accept on every common distribution
+func sha512Crypt(password, salt string, rounds int) string {
+	return sha512CryptHash(password, salt, rounds, rounds != sha512CryptRounds)
+}
+
+// sha512CryptHash hashes a password like glibc's crypt(3), naming the
+// rounds in the hash when namedRounds is set, as glibc does whenever the
+// salt named them
+func sha512CryptHash(password, salt string, rounds int, namedRounds bool) string {
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	rounds = min(max(rounds, sha512CryptMinRounds), sha512CryptMaxRounds)
+	p, s := []byte(password), []byte(salt)
+
+	b := sha512.New()
+	b.Write(p)
+	b.Write(s)
+	b.Write(p)
+	sumB := b.Sum(nil)
+
+	a := sha512.New()
+	a.Write(p)
+	a.Write(s)
+	for n := len(p); n > 0; n -= 64 {
+		a.Write(sumB[:min(n, 64)])
+	}
+	for n := len(p); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			a.Write(sumB)
+		} else {
+			a.Write(p)
+		}
+	}
+	sumA := a.Sum(nil)
+
+	dp := sha512.New()
+	for range p {
+		dp.Write(p)
+	}
+	pSeq := repeatBytes(dp.Sum(nil), len(p))
+
+	ds := sha512.New()
+	for i := 0; i < 16+int(sumA[0]); i++ {
+		ds.Write(s)
+	}
+	sSeq := repeatBytes(ds.Sum(nil), len(s))
+
+	sum := sumA
+	for i := 0; i < rounds; i++ {
+		c := sha512.New()
+		if i&1 != 0 {
+			c.Write(pSeq)
+		} else {
+			c.Write(sum)
+		}
+		if i%3 != 0 {
+			c.Write(sSeq)
+		}
+		if i%7 != 0 {
+			c.Write(pSeq)
+		}
+		if i&1 != 0 {
+			c.Write(sum)
+		} else {
+			c.Write(pSeq)
+		}
+		sum = c.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString("$6$")
+	if namedRounds {
+		out.WriteString(fmt.Sprintf("rounds=%d$", rounds))
+	}
+	out.WriteString(salt + "$")
+	order := [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4}, {47, 5, 26}, {6, 27, 48},
+		{28, 49, 7}, {50, 8, 29}, {9, 30, 51}, {31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13},
+		{56, 14, 35}, {15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19}, {62, 20, 41},
+	}
+	for _, o := range order {
+		encodeCrypt64(&out, uint(sum[o[0]])<<16|uint(sum[o[1]])<<8|uint(sum[o[2]]), 4)
+	}
+	encodeCrypt64(&out, uint(sum[63]), 2)
+	return out.String()
+}
+
+// repeatBytes repeats b up to the given length
+func repeatBytes(b []byte, length int) []byte {
+	out := make([]byte, 0, length)
+	for len(out) < length {
+		out = append(out, b[:min(len(b), length-len(out))]...)
+	}
+	return out
+}
+
+// encodeCrypt64 writes the n low 6-bit groups of w in the crypt alphabet
+func encodeCrypt64(out *strings.Builder, w uint, n int) {
+	for ; n > 0; n-- {
+		out.WriteByte(cryptAlphabet[w&0x3f])
+		w >>= 6
+	}
+}
+
+// newCryptSalt returns a random 16 character salt
+func newCryptSalt() string {
+	salt := make([]byte, 16)
+	for i := range salt {
+		salt[i] = cryptAlphabet[randomIndex(len(cryptAlphabet))]
+	}
+	return string(salt)
+}
+
+// hashPassword hashes a password with SHA-512 crypt and a random salt
+func hashPassword(password string) string {
+	return sha512Crypt(password, newCryptSalt(), sha512CryptRounds)
+}
+
+// verifySHA512Crypt checks a password against a $6$ hash
+func verifySHA512Crypt(hash, password string) (bool, error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) < 4 || fields[0] != "" || fields[1] != "6" {
+		return false, fmt.Errorf("only SHA-512 crypt ($6$) hashes can be verified here")
+	}
+	rounds, named := sha512CryptRounds, false
+	salt := fields[2]
+	if strings.HasPrefix(salt, "rounds=") {
+		n, err := strconv.Atoi(strings.TrimPrefix(salt, "rounds="))
+		if err != nil || n < 0 || len(fields) < 5 {
+			return false, fmt.Errorf("malformed SHA-512 crypt hash")
+		}
+		rounds, named, salt = n, true, fields[3]
+	}
+	computed := sha512CryptHash(password, salt, rounds, named)
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1, nil
+}
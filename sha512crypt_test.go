@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+// Reference vectors of glibc's SHA-512 crypt
+var sha512CryptVectors = []struct {
+	salt     string
+	rounds   int
+	password string
+	hash     string
+}{
+	{"saltstring", 5000, "Hello world!",
+		"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+	{"saltstringsaltstring", 10000, "Hello world!",
+		"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v."},
+	{"toolongsaltstring", 5000, "This is just a test",
+		"$6$rounds=5000$toolongsaltstrin$lQ8jolhgVRVhY4b5pZKaysCLi0QBxGoNeKQzQ3glMhwllF7oGDZxUhx1yxdYcz/e1JSbq3y6JMxxl8audkUEm0"},
+	{"anotherlongsaltstring", 1400, "a very much longer text to encrypt.  This one even stretches over morethan one line.",
+		"$6$rounds=1400$anotherlongsalts$POfYwTEok97VWcjxIiSOjiykti.o/pQs.wPvMxQ6Fm7I6IoYN3CmLs66x9t0oSwbtEW7o7UmJEiDwGqd8p4ur1"},
+	{"short", 77777, "we have a short salt string but not a short password",
+		"$6$rounds=77777$short$WuQyW2YR.hBNpjjRhpYD/ifIw05xdfeEyQoMxIXbkvr0gge1a1x3yRULJ5CCaUeOxFmtlcGZelFl5CxtgfiAc0"},
+	{"asaltof16chars..", 123456, "a short string",
+		"$6$rounds=123456$asaltof16chars..$BtCwjqMJGx5hrJhZywWvt0RLE8uZ4oPwcelCjmw2kSYu.Ec6ycULevoBK25fs2xXgMNrCzIMVcgEJAstJeonj1"},
+	{"roundstoolow", 10, "the minimum number is still observed",
+		"$6$rounds=1000$roundstoolow$kUMsbe306n21p9R.FRkW3IGn.S9NPN0x50YhH1xhLsPuWGsUSklZt58jaTfF4ZEQpyUNGc0dqbpBYYBaHHrsX."},
+}
+
+func TestSHA512Crypt(t *testing.T) {
+	for _, v := range sha512CryptVectors {
+		// glibc names the rounds whenever the salt did, which all but the
+		// first vector's salts do
+		got := sha512CryptHash(v.password, v.salt, v.rounds, v.hash[3:10] == "rounds=")
+		if got != v.hash {
+			t.Errorf("sha512CryptHash(%q, %q, %d) = %q, want %q", v.password, v.salt, v.rounds, got, v.hash)
+		}
+	}
+}
+
+func TestVerifySHA512Crypt(t *testing.T) {
+	for _, v := range sha512CryptVectors {
+		if ok, err := verifySHA512Crypt(v.hash, v.password); err != nil || !ok {
+			t.Errorf("verifySHA512Crypt(%q, %q) = %v, %v, want true", v.hash, v.password, ok, err)
+		}
+		if ok, _ := verifySHA512Crypt(v.hash, v.password+"x"); ok {
+			t.Errorf("verifySHA512Crypt(%q) accepted a wrong password", v.hash)
+		}
+	}
+	if _, err := verifySHA512Crypt("$5$saltstring$abc", "Hello world!"); err == nil {
+		t.Error("verifySHA512Crypt accepted a $5$ hash")
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash := hashPassword("correct horse")
+	if ok, err := verifySHA512Crypt(hash, "correct horse"); err != nil || !ok {
+		t.Errorf("hashPassword produced %q, which does not verify: %v", hash, err)
+	}
+}
+
+func TestTypedPasswordIsNotAHash(t *testing.T) {
+	hash := sha512CryptVectors[0].hash
+	var account UserAccount
+	account.setPassword(hash, false)
+	if account.Password != hash || account.PasswordHash != "" {
+		t.Errorf("setPassword stored a typed password as a hash: %+v", account)
+	}
+
+	account.setImportedPassword(hash, false)
+	if account.PasswordHash != hash {
+		t.Errorf("setImportedPassword did not keep an imported hash: %+v", account)
+	}
+	if account.passwordMatches(hash) {
+		t.Error("passwordMatches accepted the stored hash as a password")
+	}
+	if !account.passwordMatches("Hello world!") || !account.importedPasswordMatches(hash) {
+		t.Error("the password or imported hash does not match the stored hash")
+	}
+}
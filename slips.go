@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Login instructions printed on every slip; {server} and {username} are
+// replaced by those of the slip
+const defaultSlipInstructions = "Log in with: ssh {username}@{server}\nChange your password at the first login with: passwd"
+
+// Section of the slips of accounts without the grouping field, printed last
+const unassignedSection = "Unassigned"
+
+// slipGroupings are the ways slips are split into sections
+var slipGroupings = []struct{ Value, Label string }{
+	{"primary_group", "Primary group"},
+	{"group", "First supplementary group"},
+	{"batch", "Import batch"},
+	{"none", "No sections"},
+}
+
+// slipOrders are the ways slips are sorted within a section
+var slipOrders = []struct{ Value, Label string }{
+	{"username", "Username"},
+	{"roll_no", "Roll number"},
+	{"full_name", "Full name"},
+}
+
+// CredentialSlip is one cut-out slip handed to an account's owner
+type CredentialSlip struct {
+	Server       string
+	Username     string
+	Password     string
+	FullName     string
+	RollNo       string
+	Instructions string
+}
+
+// SlipSection is a group of slips printed from a new page
+type SlipSection struct {
+	Name  string
+	Slips []CredentialSlip
+}
+
+// slipSection returns the section an account's slip is printed in
+func slipSection(account UserAccount, grouping string) string {
+	var section string
+	switch grouping {
+	case "primary_group":
+		section = account.PrimaryGroup
+	case "group":
+		if len(account.Groups) > 0 {
+			section = account.Groups[0]
+		}
+	case "batch":
+		section = account.ImportBatch
+	case "none":
+		return ""
+	}
+	if section == "" {
+		return unassignedSection
+	}
+	return section
+}
+
+// buildSlipSections turns accounts into slips grouped into sorted sections.
+// passwords overrides the stored passwords, e.g. with those of a handout
+// when only hashes are stored; accounts without a known password are
+// returned by username instead.
+func buildSlipSections(ip string, accounts []UserAccount, passwords map[string]string, grouping, order, instructions string) ([]SlipSection, []string) {
+	bySection := make(map[string]*SlipSection)
+	var sections []*SlipSection
+	var missing []string
+	for _, account := range accounts {
+		password := account.Password
+		if p, ok := passwords[account.Username]; ok {
+			password = p
+		}
+		if password == "" {
+			missing = append(missing, account.Username)
+			continue
+		}
+
+		name := slipSection(account, grouping)
+		section, ok := bySection[name]
+		if !ok {
+			section = &SlipSection{Name: name}
+			bySection[name] = section
+			sections = append(sections, section)
+		}
+		replacer := strings.NewReplacer("{server}", ip, "{username}", account.Username)
+		section.Slips = append(section.Slips, CredentialSlip{
+			Server:       ip,
+			Username:     account.Username,
+			Password:     password,
+			FullName:     account.FullName,
+			RollNo:       account.RollNo,
+			Instructions: replacer.Replace(instructions),
+		})
+	}
+
+	key := func(slip CredentialSlip) string {
+		switch order {
+		case "roll_no":
+			return slip.RollNo
+		case "full_name":
+			return strings.ToLower(slip.FullName)
+		}
+		return slip.Username
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		if (sections[i].Name == unassignedSection) != (sections[j].Name == unassignedSection) {
+			return sections[j].Name == unassignedSection
+		}
+		return sections[i].Name < sections[j].Name
+	})
+	result := make([]SlipSection, len(sections))
+	for i, section := range sections {
+		sort.SliceStable(section.Slips, func(a, b int) bool {
+			if ka, kb := key(section.Slips[a]), key(section.Slips[b]); ka != kb {
+				return ka < kb
+			}
+			return section.Slips[a].Username < section.Slips[b].Username
+		})
+		result[i] = *section
+	}
+	return result, missing
+}
+
+// slipsHandler shows the form slips are printed from
+func slipsHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/slips.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"IPs":          sortedIPs(),
+		"Batches":      importBatches(),
+		"Groupings":    slipGroupings,
+		"Orders":       slipOrders,
+		"Instructions": defaultSlipInstructions,
+		"Handout":      handouts[r.URL.Query().Get("handout")],
+	})
+}
+
+// printSlipsHandler renders the slips of a server's accounts, of one of
+// its import batches, or of a credential handout, which is then forgotten
+// as after a download unless some of its users got no slip
+func printSlipsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimSpace(r.FormValue("server_ip"))
+	batch := r.FormValue("batch")
+	var passwords map[string]string
+	var handout *CredentialHandout
+	if id := r.FormValue("handout"); id != "" {
+		var ok bool
+		if handout, ok = handouts[id]; !ok {
+			http.Error(w, "Handout not found; it was already downloaded or has expired", http.StatusNotFound)
+			return
+		}
+		ip, batch = handout.Server, ""
+		passwords = make(map[string]string)
+		for _, credential := range handout.Credentials {
+			passwords[credential.Username] = credential.Password
+		}
+	}
+
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	// Handout users that are locked or gone from the server get no slip;
+	// they are listed and the handout is kept for them
+	var accounts []UserAccount
+	var locked, gone []string
+	if handout != nil {
+		for _, credential := range handout.Credentials {
+			account, ok := server.findAccount(credential.Username)
+			switch {
+			case !ok:
+				gone = append(gone, credential.Username)
+			case account.Locked:
+				locked = append(locked, credential.Username)
+			default:
+				accounts = append(accounts, account)
+			}
+		}
+	} else {
+		for _, account := range server.Accounts {
+			if account.Locked || (batch != "" && account.ImportBatch != batch) {
+				continue
+			}
+			accounts = append(accounts, account)
+		}
+	}
+
+	instructions := strings.ReplaceAll(r.FormValue("instructions"), "\r\n", "\n")
+	sections, missing := buildSlipSections(ip, accounts, passwords, r.FormValue("group_by"), r.FormValue("sort_by"), instructions)
+	if len(sections) == 0 && len(missing) > 0 {
+		http.Error(w, "❌ No slips to print: only password hashes are stored for the selected accounts; print their slips from a handout", http.StatusBadRequest)
+		return
+	}
+	if len(sections) == 0 {
+		http.Error(w, "❌ No slips to print: no unlocked account was selected", http.StatusBadRequest)
+		return
+	}
+	keepHandout := handout != nil && len(missing)+len(locked)+len(gone) > 0
+	if handout != nil && !keepHandout {
+		delete(handouts, handout.ID)
+	}
+
+	title := "Accounts on " + ip
+	switch {
+	case handout != nil:
+		title = handout.Title + " on " + ip
+	case batch != "":
+		title = fmt.Sprintf("Import %s on %s", batch, ip)
+	}
+	count := 0
+	for _, section := range sections {
+		count += len(section.Slips)
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	tmpl := template.Must(template.ParseFiles("templates/slips_print.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Title":       title,
+		"Sections":    sections,
+		"Count":       count,
+		"Missing":     missing,
+		"Locked":      locked,
+		"Gone":        gone,
+		"KeepHandout": keepHandout,
+	})
+}
@@ -1,154 +1,269 @@
-package main
-
-import (
-	"html/template"
-	"net/http"
-	"strings"
-)
-
-// Software represents a software package to be installed
-type Software struct {
-	Name        string
-	Description string
-	Command     string
-}
-
-// Common software packages
-var commonSoftware = []Software{
-	{Name: "nginx", Description: "Web server", Command: "apk add nginx"},
-	{Name: "python3", Description: "Python programming language", Command: "apk add python3"},
-	{Name: "nodejs", Description: "JavaScript runtime", Command: "apk add nodejs npm"},
-	{Name: "git", Description: "Version control system", Command: "apk add git"},
-	{Name: "docker", Description: "Container platform", Command: "apk add docker"},
-	{Name: "postgresql", Description: "SQL database", Command: "apk add postgresql"},
-	{Name: "mysql", Description: "MySQL database", Command: "apk add mysql mysql-client"},
-	{Name: "vim", Description: "Text editor", Command: "apk add vim"},
-	{Name: "curl", Description: "Command line tool for transferring data", Command: "apk add curl"},
-	{Name: "wget", Description: "Command line tool for retrieving files", Command: "apk add wget"},
-}
-
-// softwareHandler displays the software installation page
-func softwareHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl := template.Must(template.ParseFiles("templates/software.html"))
-
-	data := map[string]interface{}{
-		"Servers":  ipMap,
-		"Software": commonSoftware,
-	}
-
-	tmpl.Execute(w, data)
-}
-
-// installSoftwareHandler installs software on the selected server
-func installSoftwareHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Parse form data
-	err := r.ParseForm()
-	if err != nil {
-		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// Get server IP
-	serverIP := r.FormValue("server_ip")
-	if serverIP == "" {
-		http.Error(w, "Server IP is required", http.StatusBadRequest)
-		return
-	}
-
-	// Get server info
-	server, ok := ipMap[serverIP]
-	if !ok {
-		http.Error(w, "Server not found", http.StatusNotFound)
-		return
-	}
-
-	// Get software selection or custom command
-	softwareType := r.FormValue("software_type")
-	var installCommand string
-
-	if softwareType == "common" {
-		// Get selected common software
-		softwareName := r.FormValue("common_software")
-		found := false
-		for _, s := range commonSoftware {
-			if s.Name == softwareName {
-				installCommand = s.Command
-				found = true
-				break
-			}
-		}
-
-		if !found {
-			http.Error(w, "Selected software not found", http.StatusBadRequest)
-			return
-		}
-	} else if softwareType == "custom" {
-		// Get custom software name
-		customSoftware := strings.TrimSpace(r.FormValue("custom_software"))
-		if customSoftware == "" {
-			http.Error(w, "Custom software name is required", http.StatusBadRequest)
-			return
-		}
-
-		// Sanitize input to prevent command injection
-		customSoftware = sanitizePackageName(customSoftware)
-		installCommand = "apk add " + customSoftware
-	} else {
-		http.Error(w, "Invalid software type", http.StatusBadRequest)
-		return
-	}
-
-	// Build the full installation script
-	var script strings.Builder
-	script.WriteString("echo '")
-	script.WriteString(server.RootPassword)
-	script.WriteString("' | sudo -S apk update && echo '")
-	script.WriteString(server.RootPassword)
-	script.WriteString("' | sudo -S ")
-	script.WriteString(installCommand)
-
-	// Execute the command on the remote server
-	output, err := runRemoteCommand(serverIP, server.RootUsername, server.RootPassword, script.String())
-
-	// Prepare log output
-	var logBuilder strings.Builder
-	logBuilder.WriteString("📦 Software Installation Log\n\n")
-	logBuilder.WriteString("Server: " + serverIP + "\n")
-	logBuilder.WriteString("Command: " + installCommand + "\n\n")
-
-	if err != nil {
-		logBuilder.WriteString("❌ Installation failed: " + err.Error() + "\n\n")
-	} else {
-		logBuilder.WriteString("✅ Installation command executed successfully\n\n")
-	}
-
-	logBuilder.WriteString("Output:\n" + output)
-
-	// Display the results
-	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
-	tmpl.Execute(w, logBuilder.String())
-}
-
-// sanitizePackageName removes potentially dangerous characters from package names
-func sanitizePackageName(name string) string {
-	// Remove any characters that could be used for command injection
-	disallowed := []string{";", "&&", "||", "|", ">", "<", "$", "`", "\"", "'", "(", ")", "{", "}", "[", "]", "\n", "\r"}
-	result := name
-
-	for _, char := range disallowed {
-		result = strings.ReplaceAll(result, char, "")
-	}
-
-	// Split by spaces and take only the first part to ensure it's a single package name
-	parts := strings.Fields(result)
-	if len(parts) > 0 {
-		return parts[0]
-	}
-
-	return ""
-}
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// Software represents a catalog entry to be installed. Packages maps a
+// distribution ID, package manager name or "default" to the packages to install.
+type Software struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Packages    map[string][]string `json:"packages"`
+	Versions    map[string]string   `json:"versions,omitempty"`
+	PreInstall  string              `json:"pre_install,omitempty"`
+	PostInstall string              `json:"post_install,omitempty"`
+	Services    []string            `json:"services,omitempty"`
+}
+
+// Software catalog, loaded from catalogFile
+var softwareCatalog []Software
+
+// softwareHandler displays the software installation page
+func softwareHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/software.html"))
+
+	data := map[string]interface{}{
+		"Servers":  ipMap,
+		"Software": softwareCatalog,
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// Package actions offered on the software page
+var softwareActions = map[string]string{
+	"install":   "Installation",
+	"upgrade":   "Upgrade",
+	"uninstall": "Uninstallation",
+}
+
+// installSoftwareHandler installs, upgrades or uninstalls software on the selected server
+func installSoftwareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse form data
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get server IP
+	serverIP := r.FormValue("server_ip")
+	if serverIP == "" {
+		http.Error(w, "Server IP is required", http.StatusBadRequest)
+		return
+	}
+
+	// Get server info
+	server, ok := ipMap[serverIP]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	// Get the requested action, defaulting to install
+	action := r.FormValue("action")
+	if action == "" {
+		action = "install"
+	}
+	actionTitle, ok := softwareActions[action]
+	if !ok {
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve the package manager of the server
+	pm, err := packageManagerFor(serverIP)
+	if err != nil {
+		http.Error(w, "Cannot determine package manager: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	server = ipMap[serverIP]
+
+	// Get software selection or custom package
+	softwareType := r.FormValue("software_type")
+	var packages []string
+	var software Software
+	var warnings []string
+
+	if softwareType == "common" {
+		// Get selected catalog software
+		softwareName := r.FormValue("common_software")
+		var found bool
+		software, found = findSoftware(softwareName)
+		if !found {
+			http.Error(w, "Selected software not found", http.StatusBadRequest)
+			return
+		}
+
+		packages = software.packagesFor(server)
+		if len(packages) == 0 {
+			http.Error(w, fmt.Sprintf("%s has no packages for %s (%s)", software.Name, server.OSID, pm.Name), http.StatusBadRequest)
+			return
+		}
+	} else if softwareType == "custom" {
+		// Get custom software name
+		customSoftware := strings.TrimSpace(r.FormValue("custom_software"))
+		if customSoftware == "" {
+			http.Error(w, "Custom software name is required", http.StatusBadRequest)
+			return
+		}
+
+		// Validate against the package manager's naming rules
+		packages, err = pm.parsePackageList(customSoftware)
+		if err != nil {
+			http.Error(w, "❌ Invalid package names:\n"+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Make sure the repositories provide every package before installing
+		if action == "install" {
+			var missing []string
+			withStoreUnlocked(func() { missing, err = pm.missingPackages(serverIP, server, packages) })
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			if len(missing) > 0 {
+				http.Error(w, fmt.Sprintf("❌ Not found in the %s repositories of %s: %s\nNothing was installed.",
+					pm.Name, serverIP, strings.Join(missing, ", ")), http.StatusBadRequest)
+				return
+			}
+		}
+	} else {
+		http.Error(w, "Invalid software type", http.StatusBadRequest)
+		return
+	}
+
+	// Build the script for the requested action
+	var script, command string
+	switch action {
+	case "install":
+		command = pm.Install
+		if software.Name != "" {
+			script, warnings, err = software.installScript(server, pm)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		} else {
+			script = pm.installScript(server.RootPassword, packages)
+		}
+	case "upgrade":
+		command = pm.Upgrade
+		script = pm.upgradeScript(server.RootPassword, packages)
+	case "uninstall":
+		command = pm.Remove
+		script = pm.removeScript(server.RootPassword, packages)
+	}
+
+	// Execute the command on the remote server
+	output, err := runRemoteUnlocked(serverIP, server, script)
+
+	// Prepare log output
+	var logBuilder strings.Builder
+	logBuilder.WriteString("📦 Software " + actionTitle + " Log\n\n")
+	logBuilder.WriteString("Server: " + serverIP + "\n")
+	logBuilder.WriteString("OS: " + server.OSName + " (" + pm.Name + ")\n")
+	logBuilder.WriteString("Command: " + command + " " + strings.Join(packages, " ") + "\n\n")
+	for _, warning := range warnings {
+		logBuilder.WriteString("⚠️ " + warning + "\n")
+	}
+
+	if err != nil {
+		logBuilder.WriteString("❌ " + actionTitle + " failed: " + err.Error() + "\n\n")
+	} else {
+		logBuilder.WriteString("✅ " + actionTitle + " command executed successfully\n\n")
+	}
+
+	logBuilder.WriteString("Output:\n" + output)
+
+	// Display the results
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// InventoryItem is the state of one catalog entry on a server
+type InventoryItem struct {
+	Software  Software
+	Packages  []string
+	Installed map[string]string
+	Updates   map[string]string
+	Missing   []string
+	Status    string
+}
+
+// softwareInventoryHandler lists installed packages on a server against the catalog
+func softwareInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimSpace(r.URL.Query().Get("ip"))
+	server, ok := ipMap[ip]
+	if !ok {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	pm, err := packageManagerFor(ip)
+	if err != nil {
+		http.Error(w, "Cannot determine package manager: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	server = ipMap[ip]
+
+	output, err := runRemoteUnlocked(ip, server, pm.inventoryScript(server.RootPassword))
+	if err != nil {
+		http.Error(w, "Error reading package inventory: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	inv := pm.parseInventory(output)
+
+	var items []InventoryItem
+	for _, software := range softwareCatalog {
+		item := InventoryItem{
+			Software:  software,
+			Packages:  software.packagesFor(server),
+			Installed: make(map[string]string),
+			Updates:   make(map[string]string),
+		}
+		for _, pkg := range item.Packages {
+			if version, ok := inv.Installed[pkg]; ok {
+				item.Installed[pkg] = version
+				if update, ok := inv.Upgrades[pkg]; ok {
+					item.Updates[pkg] = update
+				}
+			} else {
+				item.Missing = append(item.Missing, pkg)
+			}
+		}
+
+		switch {
+		case len(item.Packages) == 0:
+			item.Status = "unavailable"
+		case len(item.Missing) == len(item.Packages):
+			item.Status = "missing"
+		case len(item.Missing) > 0:
+			item.Status = "partial"
+		case len(item.Updates) > 0:
+			item.Status = "update"
+		default:
+			item.Status = "installed"
+		}
+		items = append(items, item)
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/software_inventory.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"IP":             ip,
+		"Server":         server,
+		"Items":          items,
+		"InstalledCount": len(inv.Installed),
+		"UpgradeCount":   len(inv.Upgrades),
+	})
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const uploadDir = "uploads"
+
+// How often kept uploads past their retention period are purged
+const uploadPurgeInterval = 10 * time.Minute
+
+// Spreadsheets and key archives are zip files; every other upload is text
+var zipExtensions = map[string]bool{".xlsx": true, ".xlsm": true, ".ods": true, ".zip": true}
+
+// keptUploadPattern matches the names keep generates: an ID from newID and
+// an optional lowercase extension
+var keptUploadPattern = regexp.MustCompile(`^[0-9a-f]{12}(\.[a-z0-9]+)?$`)
+
+// Memory multipart forms may use before files go to temporary files, as
+// net/http uses by default
+const multipartMemory = 32 << 20
+
+// Upload is a file received with a request. It is read into memory and
+// only kept, under a generated name, when a later request needs it, such as
+// the import a preview leads to.
+type Upload struct {
+	// Name is generated when the upload is kept
+	Name string
+	// Filename is the base name the client sent, for display only
+	Filename string
+	Data     []byte
+	Saved    time.Time
+}
+
+// memoryUploads are the kept uploads when uploads are not written to disk,
+// guarded by storeMu
+var memoryUploads = make(map[string]*Upload)
+
+// limitRequestSize caps request bodies at the upload size limit. Bodies
+// announced as larger are refused outright; others fail when read past it.
+// It wraps lockStore, so multipart uploads are read before the store is
+// locked, entirely in memory when uploads are never to touch the disk.
+func limitRequestSize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storeMu.Lock()
+		maxMB, inMemory := appSettings.MaxUploadMB, appSettings.UploadsInMemory
+		storeMu.Unlock()
+
+		limit := int64(maxMB) << 20
+		tooLarge := fmt.Sprintf("❌ The upload is larger than the %d MB limit", maxMB)
+		if r.ContentLength > limit {
+			http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			memory := int64(multipartMemory)
+			if inMemory {
+				memory = max(limit, memory)
+			}
+			if err := r.ParseMultipartForm(memory); err != nil {
+				var maxBytes *http.MaxBytesError
+				if errors.As(err, &maxBytes) {
+					http.Error(w, tooLarge, http.StatusRequestEntityTooLarge)
+				} else {
+					http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+				}
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// receiveUpload reads an uploaded file and checks that its content matches
+// its extension. Nothing is written to disk.
+func receiveUpload(r *http.Request, field string) (*Upload, error) {
+	file, handler, err := r.FormFile(field)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, fmt.Errorf("the upload is larger than the %d MB limit", appSettings.MaxUploadMB)
+		}
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+	upload := &Upload{Filename: filepath.Base(handler.Filename), Data: data}
+	if err := upload.sniff(); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// sniff checks the detected content type of an upload against its
+// extension, so that e.g. a binary file renamed to .csv is rejected before
+// it is parsed
+func (upload *Upload) sniff() error {
+	ext := strings.ToLower(filepath.Ext(upload.Filename))
+	contentType := http.DetectContentType(upload.Data)
+	switch {
+	case zipExtensions[ext] && contentType != "application/zip":
+	case !zipExtensions[ext] && !strings.HasPrefix(contentType, "text/"):
+	default:
+		return nil
+	}
+	return fmt.Errorf("%s does not look like a %s file, its content is %s", upload.Filename, ext, contentType)
+}
+
+// keep stores an upload under a generated name, on disk or in memory,
+// until it is processed or its retention period is over
+func (upload *Upload) keep() error {
+	ext := strings.ToLower(filepath.Ext(upload.Filename))
+	if _, err := findImporter(ext); err != nil && ext != ".zip" {
+		ext = ""
+	}
+	upload.Name = newID() + ext
+	upload.Saved = time.Now()
+	if appSettings.UploadsInMemory {
+		memoryUploads[upload.Name] = upload
+		return nil
+	}
+	if err := os.MkdirAll(uploadDir, 0700); err != nil {
+		return fmt.Errorf("error saving file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(uploadDir, upload.Name), upload.Data, 0600); err != nil {
+		return fmt.Errorf("error saving file: %v", err)
+	}
+	return nil
+}
+
+// keptUpload returns an upload kept by an earlier request, e.g. the file an
+// import preview was made from. The client's file name comes back from the
+// form, as it is not kept on disk.
+func keptUpload(name, filename string) (*Upload, error) {
+	if !keptUploadPattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid upload name %q", name)
+	}
+	if filename == "" || !strings.EqualFold(filepath.Ext(filename), filepath.Ext(name)) {
+		filename = name
+	}
+	unavailable := fmt.Errorf("uploaded file %s is no longer available, upload it again", filepath.Base(filename))
+
+	if upload, ok := memoryUploads[name]; ok {
+		return upload, nil
+	}
+	path := filepath.Join(uploadDir, name)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, unavailable
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, unavailable
+	}
+	return &Upload{Name: name, Filename: filepath.Base(filename), Data: data, Saved: info.ModTime()}, nil
+}
+
+// discardUpload removes a kept upload once it has been processed
+func discardUpload(name string) {
+	if !keptUploadPattern.MatchString(name) {
+		return
+	}
+	delete(memoryUploads, name)
+	os.Remove(filepath.Join(uploadDir, name))
+}
+
+// purgeUploads removes kept uploads older than the retention period, and
+// every kept upload in the uploads directory when uploads are kept in
+// memory. Files not named by keep are left alone. It returns the number of
+// uploads removed.
+func purgeUploads(now time.Time) int {
+	cutoff := now.Add(-time.Duration(appSettings.UploadRetentionHours) * time.Hour)
+	purged := 0
+	for name, upload := range memoryUploads {
+		if upload.Saved.Before(cutoff) {
+			delete(memoryUploads, name)
+			purged++
+		}
+	}
+
+	entries, err := os.ReadDir(uploadDir)
+	if err != nil {
+		return purged
+	}
+	for _, entry := range entries {
+		if !keptUploadPattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if appSettings.UploadsInMemory || info.ModTime().Before(cutoff) {
+			if os.Remove(filepath.Join(uploadDir, entry.Name())) == nil {
+				purged++
+			}
+		}
+	}
+	return purged
+}
+
+// startUploadPurge purges expired uploads now and then every
+// uploadPurgeInterval in the background
+func startUploadPurge() {
+	go func() {
+		for {
+			storeMu.Lock()
+			if n := purgeUploads(time.Now()); n > 0 {
+				fmt.Printf("Purged %d expired uploads\n", n)
+			}
+			storeMu.Unlock()
+			time.Sleep(uploadPurgeInterval)
+		}
+	}()
+}
+
+// uploadSettingsHandler updates the upload size limit, where uploads are
+// kept and for how long
+func uploadSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	maxMB, err := strconv.Atoi(strings.TrimSpace(r.FormValue("max_upload_mb")))
+	if err != nil || maxMB < 1 || maxMB > 1024 {
+		http.Error(w, "The upload limit must be between 1 and 1024 MB", http.StatusBadRequest)
+		return
+	}
+	hours, err := strconv.Atoi(strings.TrimSpace(r.FormValue("upload_retention_hours")))
+	if err != nil || hours < 0 {
+		http.Error(w, "Invalid retention period", http.StatusBadRequest)
+		return
+	}
+	appSettings.MaxUploadMB = maxMB
+	appSettings.UploadRetentionHours = hours
+	appSettings.UploadsInMemory = r.FormValue("uploads_in_memory") == "on"
+	if err := saveSettings(); err != nil {
+		http.Error(w, "Error saving settings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var logBuilder strings.Builder
+	logBuilder.WriteString("✅ Upload settings saved.\n")
+	if n := purgeUploads(time.Now()); n > 0 {
+		logBuilder.WriteString(fmt.Sprintf("🧹 %d kept uploads purged\n", n))
+	}
+	tmpl := template.Must(template.ParseFiles("templates/logs.html"))
+	tmpl.Execute(w, logBuilder.String())
+}
+
+// hasUpload reports whether a request carries a file in the given field
+func hasUpload(r *http.Request, field string) bool {
+	_, _, err := r.FormFile(field)
+	return err == nil
+}
+
+// readTableFile reads the rows of an upload with the importer of its
+// format, and lists the sheets of spreadsheets
+func readTableFile(upload *Upload, sheet string) ([][]string, []string, error) {
+	importer, err := findImporter(upload.Filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	return importer.Read(upload.Data, sheet)
+}
+
+// readUploadedRows reads an uploaded CSV or Excel file and returns its rows
+// without the header row
+func readUploadedRows(r *http.Request, field string) ([][]string, error) {
+	upload, err := receiveUpload(r, field)
+	if err != nil {
+		return nil, err
+	}
+	rows, _, err := readTableFile(upload, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip header row
+	if len(rows) > 0 {
+		rows = rows[1:]
+	}
+	return rows, nil
+}
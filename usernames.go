@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Longest username useradd accepts
+const maxUsernameLength = 32
+
+// UsernameRule describes how usernames are made from imported names when
+// the import has no username column
+type UsernameRule struct {
+	// full, first_last, initial_last, first_initial or rollno
+	Style     string `json:"style"`
+	Separator string `json:"separator"`
+	Lowercase bool   `json:"lowercase"`
+	// Fixed text every username starts with, e.g. "s"
+	Prefix string `json:"prefix"`
+	// Whether the roll number comes before the name part
+	RollNoPrefix bool `json:"rollno_prefix"`
+	MaxLength    int  `json:"max_length"`
+}
+
+// usernameStyles are the ways a name becomes a username, shown for
+// "Jane Mary Doe"
+var usernameStyles = []struct {
+	Name  string
+	Label string
+}{
+	{"full", "Every word (jane_mary_doe)"},
+	{"first_last", "First and last name (jane_doe)"},
+	{"initial_last", "First initial and last name (jdoe)"},
+	{"first_initial", "First name and last initial (janed)"},
+	{"rollno", "Roll number only"},
+}
+
+// Letters that do not decompose into a base letter and accents, and the
+// Cyrillic alphabet, written in lowercase
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'ø': "o", 'đ': "d", 'ł': "l", 'œ': "oe", 'þ': "th", 'ð': "d", 'ı': "i", 'ħ': "h",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ж': "zh", 'з': "z", 'и': "i", 'к': "k",
+	'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f",
+	'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'є': "ye", 'ґ': "g",
+}
+
+// validate checks a rule before it is saved
+func (rule UsernameRule) validate() error {
+	known := false
+	for _, style := range usernameStyles {
+		known = known || style.Name == rule.Style
+	}
+	if !known {
+		return fmt.Errorf("unknown username style %q", rule.Style)
+	}
+	switch rule.Separator {
+	case "", "_", ".", "-":
+	default:
+		return fmt.Errorf("the separator must be empty, '_', '.' or '-'")
+	}
+	if rule.Prefix != "" && !usernamePattern.MatchString(rule.Prefix) {
+		return fmt.Errorf("the prefix %q must start with a letter and hold only letters, digits, '_', '.' and '-'", rule.Prefix)
+	}
+	if rule.MaxLength < 3 || rule.MaxLength > maxUsernameLength {
+		return fmt.Errorf("the maximum length must be between 3 and %d", maxUsernameLength)
+	}
+	return nil
+}
+
+// transliterate writes a name in ASCII: accents are dropped, other Latin
+// letters and Cyrillic are spelled out, and anything else is left out
+func transliterate(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+		default:
+			t := transliterations[unicode.ToLower(r)]
+			if unicode.IsUpper(r) && t != "" {
+				t = strings.ToUpper(t[:1]) + t[1:]
+			}
+			b.WriteString(t)
+		}
+	}
+	return b.String()
+}
+
+// nameWords splits a transliterated name into words of letters and digits,
+// so "O'Brien" stays one word
+func nameWords(name string) []string {
+	var words []string
+	for _, field := range strings.Fields(transliterate(name)) {
+		var b strings.Builder
+		for _, r := range field {
+			if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				b.WriteRune(r)
+			}
+		}
+		if b.Len() > 0 {
+			words = append(words, b.String())
+		}
+	}
+	return words
+}
+
+// maxLength returns the length limit of the rule, capped by useradd's
+func (rule UsernameRule) maxLength() int {
+	if rule.MaxLength <= 0 || rule.MaxLength > maxUsernameLength {
+		return maxUsernameLength
+	}
+	return rule.MaxLength
+}
+
+// derive makes a username from a name and roll number, at most MaxLength
+// long
+func (rule UsernameRule) derive(name, rollNo string) (string, error) {
+	words := nameWords(name)
+	roll := strings.Join(nameWords(rollNo), "")
+
+	var part string
+	if len(words) > 0 {
+		first, last := words[0], words[len(words)-1]
+		switch rule.Style {
+		case "full":
+			part = strings.Join(words, rule.Separator)
+		case "first_last":
+			part = first
+			if len(words) > 1 {
+				part += rule.Separator + last
+			}
+		case "initial_last":
+			part = last
+			if len(words) > 1 {
+				part = first[:1] + last
+			}
+		case "first_initial":
+			part = first
+			if len(words) > 1 {
+				part += last[:1]
+			}
+		}
+	}
+
+	var pieces []string
+	if rule.RollNoPrefix || rule.Style == "rollno" {
+		if roll == "" {
+			return "", fmt.Errorf("the username rule needs a roll number")
+		}
+		pieces = append(pieces, roll)
+	}
+	if part != "" {
+		pieces = append(pieces, part)
+	}
+	if len(pieces) == 0 {
+		return "", fmt.Errorf("no letters or digits in the name %q to make a username from", name)
+	}
+
+	username := rule.Prefix + strings.Join(pieces, rule.Separator)
+	if rule.Lowercase {
+		username = strings.ToLower(username)
+	}
+	username = strings.TrimRight(username[:min(len(username), rule.maxLength())], "_.-")
+	if !usernamePattern.MatchString(username) {
+		return "", fmt.Errorf("username %q must start with a letter; set a prefix in the username rules", username)
+	}
+	return username, nil
+}
+
+// uniqueUsername appends the lowest free number to a taken username,
+// shortening it to stay within maxLength
+func uniqueUsername(username string, maxLength int, taken func(string) bool) (string, error) {
+	if !taken(username) {
+		return username, nil
+	}
+	for n := 2; n < 1000; n++ {
+		suffix := strconv.Itoa(n)
+		base := username[:min(len(username), maxLength-len(suffix))]
+		if candidate := base + suffix; !taken(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free username left for %s", username)
+}
+
+// samePerson reports whether a stored account was made for the same row
+// of an earlier import, so a repeated import reuses its username and the
+// conflict policy applies instead of a numbered duplicate
+func (account UserAccount) samePerson(name, rollNo string) bool {
+	if rollNo != "" || account.RollNo != "" {
+		return account.RollNo == rollNo
+	}
+	return account.OriginalName != "" && account.OriginalName == name
+}
+
+// usernameRulesHandler shows and updates the username rule of imports
+// without a username column
+func usernameRulesHandler(w http.ResponseWriter, r *http.Request) {
+	var message string
+	rule := appSettings.UsernameRule
+
+	if r.Method == http.MethodPost {
+		maxLength, err := strconv.Atoi(strings.TrimSpace(r.FormValue("max_length")))
+		if err != nil {
+			maxLength = 0
+		}
+		rule = UsernameRule{
+			Style:        r.FormValue("style"),
+			Separator:    r.FormValue("separator"),
+			Lowercase:    r.FormValue("lowercase") == "on",
+			Prefix:       strings.TrimSpace(r.FormValue("prefix")),
+			RollNoPrefix: r.FormValue("rollno_prefix") == "on",
+			MaxLength:    maxLength,
+		}
+		if err := rule.validate(); err != nil {
+			message = "❌ " + err.Error()
+		} else {
+			appSettings.UsernameRule = rule
+			if err := saveSettings(); err != nil {
+				message = "❌ Error saving settings: " + err.Error()
+			} else {
+				message = "✅ Username rules saved"
+			}
+		}
+	}
+
+	// Show what the rule makes of a few awkward names
+	type example struct{ Name, RollNo, Username, Error string }
+	var examples []example
+	for _, sample := range [][2]string{
+		{"Jane Mary Doe", "2024CS101"},
+		{"José Álvarez-Núñez", "2024CS102"},
+		{"Seán O'Brien", "2024CS103"},
+		{"Łukasz Żółć", "2024CS104"},
+		{"Мария Иванова", "2024CS105"},
+		{"Venkata Subramanian Ramachandran Krishnamurthy", "2024CS106"},
+	} {
+		e := example{Name: sample[0], RollNo: sample[1]}
+		if username, err := rule.derive(sample[0], sample[1]); err != nil {
+			e.Error = err.Error()
+		} else {
+			e.Username = username
+		}
+		examples = append(examples, e)
+	}
+
+	tmpl := template.Must(template.ParseFiles("templates/username_rules.html"))
+	tmpl.Execute(w, map[string]interface{}{
+		"Rule":     rule,
+		"Styles":   usernameStyles,
+		"Examples": examples,
+		"Message":  message,
+	})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Validation reports are kept in memory, the newest ones only
+const maxValidationReports = 50
+
+// FieldError is an invalid value of one import field
+type FieldError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *FieldError) Error() string { return e.Err.Error() }
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// fieldError ties an error to the import field and value that caused it
+func fieldError(field, value string, err error) error {
+	return &FieldError{Field: field, Value: value, Err: err}
+}
+
+// ValidationIssue is a problem found in one row of an uploaded file. Rows
+// with an error are skipped; rows with a warning are imported.
+type ValidationIssue struct {
+	Row      int
+	Column   string
+	Value    string
+	Reason   string
+	Severity string
+}
+
+// ValidationReport lists the issues of an uploaded file so it can be fixed
+// and submitted again
+type ValidationReport struct {
+	ID       string
+	Filename string
+	Server   string
+	Created  time.Time
+	Rows     int
+	Valid    int
+	Issues   []ValidationIssue
+}
+
+// validationReports are guarded by storeMu, oldest first
+var validationReports []*ValidationReport
+
+func newValidationReport(filename, server string) *ValidationReport {
+	return &ValidationReport{ID: newID(), Filename: filename, Server: server, Created: time.Now()}
+}
+
+// add records an issue; row 0 stands for the whole file
+func (report *ValidationReport) add(row int, column, value, reason, severity string) {
+	report.Issues = append(report.Issues, ValidationIssue{
+		Row:      row,
+		Column:   column,
+		Value:    value,
+		Reason:   reason,
+		Severity: severity,
+	})
+}
+
+// count returns the number of issues of a severity
+func (report *ValidationReport) count(severity string) int {
+	n := 0
+	for _, issue := range report.Issues {
+		if issue.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+func (report *ValidationReport) Errors() int { return report.count("error") }
+
+func (report *ValidationReport) Warnings() int { return report.count("warning") }
+
+// keep stores a report for download, dropping the oldest ones
+func (report *ValidationReport) keep() {
+	validationReports = append(validationReports, report)
+	if len(validationReports) > maxValidationReports {
+		validationReports = validationReports[len(validationReports)-maxValidationReports:]
+	}
+}
+
+// findValidationReport looks up a kept report
+func findValidationReport(id string) *ValidationReport {
+	for _, report := range validationReports {
+		if report.ID == id {
+			return report
+		}
+	}
+	return nil
+}
+
+// RowLabel returns the row of an issue as shown in reports
+func (issue ValidationIssue) RowLabel() string {
+	if issue.Row == 0 {
+		return "file"
+	}
+	return strconv.Itoa(issue.Row)
+}
+
+// String writes the report for an operation log, with the download links
+// of kept reports
+func (report *ValidationReport) String() string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📋 Validation of %s: %d rows, %d valid, %d errors, %d warnings\n",
+		report.Filename, report.Rows, report.Valid, report.Errors(), report.Warnings()))
+	if len(report.Issues) == 0 {
+		return b.String()
+	}
+
+	b.WriteString(fmt.Sprintf("%-6s %-18s %-24s %s\n", "Row", "Column", "Value", "Reason"))
+	for _, issue := range report.Issues {
+		icon := "❌"
+		if issue.Severity == "warning" {
+			icon = "⚠️"
+		}
+		b.WriteString(fmt.Sprintf("%-6s %-18s %-24s %s %s\n", issue.RowLabel(), issue.Column,
+			abbreviate(issue.Value, 24), icon, issue.Reason))
+	}
+	if findValidationReport(report.ID) != nil {
+		b.WriteString(fmt.Sprintf("Download the report: /imports/report?id=%s&format=csv or &format=xlsx\n", report.ID))
+	}
+	return b.String()
+}
+
+// abbreviate shortens a value to n characters for a log column
+func abbreviate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return s
+}
+
+// validationReportHandler serves a kept report as CSV or XLSX
+func validationReportHandler(w http.ResponseWriter, r *http.Request) {
+	report := findValidationReport(r.URL.Query().Get("id"))
+	if report == nil {
+		http.Error(w, "Validation report not found; it may have been replaced by newer ones", http.StatusNotFound)
+		return
+	}
+
+	header := []string{"Row", "Column", "Value", "Reason", "Severity"}
+	name := strings.Map(func(r rune) rune {
+		if r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-') {
+			return r
+		}
+		return '_'
+	}, strings.TrimSuffix(report.Filename, filepath.Ext(report.Filename)))
+	base := fmt.Sprintf("validation_%s_%s", name, report.Created.Format("20060102-150405"))
+
+	switch r.URL.Query().Get("format") {
+	case "xlsx":
+		f := excelize.NewFile()
+		defer f.Close()
+		sheet := "Validation"
+		f.SetSheetName(f.GetSheetName(0), sheet)
+		bold, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+		f.SetSheetRow(sheet, "A1", &header)
+		f.SetRowStyle(sheet, 1, 1, bold)
+		for i, issue := range report.Issues {
+			var row interface{} = issue.Row
+			if issue.Row == 0 {
+				row = issue.RowLabel()
+			}
+			cell, _ := excelize.CoordinatesToCellName(1, i+2)
+			f.SetSheetRow(sheet, cell, &[]interface{}{row, issue.Column, issue.Value, issue.Reason, issue.Severity})
+		}
+		f.SetColWidth(sheet, "B", "C", 24)
+		f.SetColWidth(sheet, "D", "D", 60)
+		f.SetPanes(sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"})
+
+		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.xlsx", base))
+		f.Write(w)
+	default:
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", base))
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		for _, issue := range report.Issues {
+			writer.Write([]string{issue.RowLabel(), issue.Column, issue.Value, issue.Reason, issue.Severity})
+		}
+		writer.Flush()
+	}
+}
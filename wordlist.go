@@ -0,0 +1,68 @@
+package main
+
+import "strings"
+
+// passphraseWords are short, common and easy to type words for diceware-style
+// passphrases
+var passphraseWords = strings.Fields(`
+able acid acorn actor adapt agent agile alarm album alert alley alpha
+amber ample angle ankle apple apron arena argue armor aroma arrow atlas
+attic audio autumn avid awake award axis bacon badge bagel baker balmy
+bamboo banjo barn basil basin batch beach beacon beard beast bench berry
+bike birch bison blade blank blaze blend bliss blond bloom board boat
+bonus boost booth boots bounce bowl boxer brain brave bread brick bride
+brief brisk broom brush bubble bucket buddy buggy bulb bunch bunny butter
+cabin cable cactus cadet camel camera canal candle candy canoe canvas canyon
+cargo carol carpet carrot cart castle cedar cello chalk champ chant charm
+chart chase cheek cheese cherry chess chest chick chief chili chimp chip
+choir chord chorus cider cinema circle citrus civic clamp clap clay clerk
+cliff climb clock cloth cloud clover clown coach coast cobra cocoa comet
+comic coral cork corn cotton couch cough court cousin cover coyote crab
+craft crane crayon cream creek crest crisp crow crown crumb crust cubic
+cupid curly curve cycle daisy dance dash dawn decal deer delta denim
+depot desert desk dial diary dice diner disco ditch diver dock dodge
+dolphin donut dove dozen draft dragon drama dream dress drift drill drum
+duck dune dusk dwarf eagle early earth easel echo eclipse edge eel
+elbow elder elm ember emu engine equal error essay ethic event exact
+exit fable fabric falcon famous fancy farm feast feather fence ferry fiber
+field fiesta film finch fiord fire flag flame flask fleet flint flock
+flora flute focus foggy folk forest forge fork fossil fox frame fresh
+frog frost fruit fudge funny gadget galaxy gallon game garden garlic gate
+gecko gem genie ghost giant ginger giraffe glade glass glide globe glove
+goat gold golf goose gorge grain grape graph grass gravy great green
+grill groove guard guest guide guitar gulf gust habit hammer harbor harp
+hatch hawk hazel heart hedge helmet herb hero heron hiker hill hippo
+hobby honey hood hope horse hotel hound house humor hunter husky igloo
+image inch index ink input iris iron island ivory ivy jacket jade
+jaguar jam jar jazz jelly jewel jockey jolly judge juice jumbo jungle
+kayak kettle kiosk kite kitten kiwi knee knight koala label ladder lake
+lamp lane laptop latch lava lawn layer leaf lemon lens level lilac
+lily lime linen lion lizard llama lobby lobster locket lodge logic lotus
+lucky lunar lunch lyric magic magnet mango maple marble march market mask
+meadow medal melon mentor menu merit mesa metal meteor micro mild mill
+mint mirror mitten mocha model mole monk moose mosaic moss motel motor
+mouse mural music mustard myth nacho napkin navy nectar needle nest nickel
+noble noodle north novel nugget nurse oak oasis ocean olive omega onion
+opal opera orbit orchid otter oval owl oxygen oyster paddle pagoda palm
+panda panel panther paper parade parcel park parrot pasta patch path peach
+peak peanut pearl pebble pecan pedal pelican pencil pepper perch piano pickle
+picnic pilot pine pixel pizza plane planet plaza plum poem polar pond
+pony poppy porch potato pouch prism prize puffin pulse pumpkin puppy puzzle
+quail quartz queen quest quiet quilt quiz rabbit radar radio raft rain
+ramp ranch raven razor recipe reef relay rhino ribbon rice ridge rink
+river road robin robot rocket rodeo roof room rose rover ruby rugby
+ruler saddle safari saga salad salmon salsa sand satin sauce scarf school
+scout seal season seed shadow shark shelf shell shore shrub sierra silk
+silver siren skate sketch ski sky slate sled slope smile snack snail
+snake snow soap sock sofa solar sonic soup spark spice spider spoon
+sport spring sprout squid stable stamp star steam stem stone stool storm
+story stove straw stream stripe studio sugar summit sun surf swan sweater
+swift syrup table taco talon tango tank tape target tea teapot tempo
+tent thistle thorn thunder ticket tiger tile timber toast token tomato topaz
+torch totem tower track trail train tree trend tribe trophy trout truck
+tulip tuna tundra turtle tutor twig twin umbrella unicorn union urban valley
+vanilla vapor velvet venue vessel video violet violin visor vivid voice volcano
+voyage wafer waffle wagon walnut walrus wand water wave wax whale wheat
+wheel whisk willow window wing winter wizard wolf wombat wood wool world
+yacht yak yarn yeti yodel yogurt zebra zenith zero zinc zipper zone
+`)